@@ -1,21 +1,45 @@
+// Package cli7z wraps the 7-Zip command line (7zz) to list, test, extract and create archives.
+//
+// Every TFile keeps the state of its last command (ErrorState, Stderr, Warnings), so a TFile must not
+// be used from several goroutines at once. Distinct TFile values share nothing but the read-only
+// package settings (BINARY_NAME, MaxCompressionRatio) and are safe to use from different goroutines.
 package cli7z
 
 import (
-	"bufio"
+	"bytes"
+	"context"
 	"errors"
-	"log"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
 	"os/exec"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 )
 
-var BINARY_NAME = "7zz"
+const defaultBinary = "7zz"
+
+var BINARY_NAME = defaultBinary
 
 type THeader struct {
 	Data map[string]string
+	// Key of the last line, to join the lines of a multi-line Comment
+	last string
+	// Raw lines in order, for Listing
+	lines []string
 }
 
 type TEntry struct {
-	Data map[string]string
+	Data       map[string]string
+	Size       int64
+	PackedSize int64
+	Modified   time.Time
+	Created    time.Time
+	Accessed   time.Time
+	CRC        string
 }
 
 func newHeader() *THeader {
@@ -25,9 +49,15 @@ func newHeader() *THeader {
 }
 
 func (h *THeader) addKey(s string) {
+	h.lines = append(h.lines, s)
+	if h.last == "Comment" && !strings.Contains(s, " = ") {
+		h.Data["Comment"] += "\n" + s
+		return
+	}
 	key, value, succeed := strings.Cut(s, " = ")
 	if succeed {
 		h.Data[key] = value
+		h.last = key
 	} else {
 		key, value, succeed = strings.Cut(s, ": ")
 		if succeed {
@@ -42,15 +72,65 @@ func newEntry() *TEntry {
 	return &entry
 }
 
+// Keys never contain " = ", so splitting on the first one keeps values
+// like "Path = a = b.txt" intact
 func (e *TEntry) addKey(s string) {
 	key, value, succeed := strings.Cut(s, " = ")
 	if succeed {
 		e.Data[key] = value
+		switch key {
+		case "Size":
+			e.Size = parseSize(value)
+		case "Packed Size":
+			e.PackedSize = parseSize(value)
+		case "Modified":
+			e.Modified = parseTime(value)
+		case "Created":
+			e.Created = parseTime(value)
+		case "Accessed":
+			e.Accessed = parseTime(value)
+		case "CRC":
+			e.CRC = value
+		}
+	}
+}
+
+// Add a line of the entry block. Path is the first key of a block, so a line without " = "
+// right after it is the rest of a file name holding a newline
+func (e *TEntry) addLine(s string) {
+	if !strings.Contains(s, " = ") {
+		if path, ok := e.Data["Path"]; ok && len(e.Data) == 1 {
+			e.Data["Path"] = path + "\n" + s
+		}
+		return
 	}
+	e.addKey(s)
+}
+
+// Parse a size value, empty or malformed values (directories) are treated as 0
+func parseSize(s string) int64 {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// Layout of the timestamps in 7z output, fractional seconds are accepted by time.Parse
+const timeLayout = "2006-01-02 15:04:05"
+
+// Parse a 7z timestamp (local time), malformed values are left as zero time
+func parseTime(s string) time.Time {
+	t, err := time.ParseInLocation(timeLayout, s, time.Local)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
 }
 
 type TFile struct {
 	File       string
+	Binary     string
 	Type       string
 	Listing    string
 	Header     *THeader
@@ -58,12 +138,178 @@ type TFile struct {
 	Encrypted  bool
 	Password   string
 	ErrorState string
+	// The listing itself needs the password (7z -mhe, rar -hp), the entry names are hidden without it.
+	// Encrypted is set as well.
+	HeaderEncrypted bool
+	// Stderr of the last 7z command, genuine errors and warnings without the informational stdout
+	Stderr string
+	// Output of the last 7z command, stdout followed by stderr, kept on success too for debugging.
+	// Bounded to its last MiB, set it to "" to free it. Streamed contents
+	// (OpenEntry, ExtractToWriter) are not part of it and ForEachEntry leaves it untouched.
+	LastOutput string
+	// Debug messages of the 7z commands: the command line (password masked) when started, then
+	// the exit code and duration for the ones not streaming their output. Nil logs nothing.
+	Logger *slog.Logger
+	// Runs the 7z commands, os/exec in WorkDir with Env if not set
+	Runner Runner
+	// Treat a 7z exit code 1 (warnings only, like a skipped symlink) as success
+	AllowWarnings bool
+	// Warning lines ("WARNING: ...", "Cannot ...") of the last extract or test command
+	Warnings []string
+	// Concurrent 7z processes of FindPassword, runtime.NumCPU() if not set
+	Workers int
+	// Deadline of each 7z process, killed and failing with ErrTimeout once exceeded. 0 means no timeout.
+	Timeout time.Duration
+	// Switches added verbatim to the list, extract and test commands, right after the command name,
+	// for the ones with no first-class support (like -snl). Switches changing the output can break its parsing.
+	ExtraArgs []string
+	// Leave 7z printing names in the locale charset. By default -sccUTF-8 is passed outside Windows,
+	// so non-ASCII names in Data["Path"] are not garbled under a non UTF-8 locale.
+	NativeCharset bool
+	// Working directory of the 7z processes, the relative paths given to 7z (File, extract folders, ...)
+	// resolve against it, for the file operations done in Go too. Empty means the current one.
+	// Not passed to a custom Runner.
+	WorkDir string
+	// Variables like "TMPDIR=/data/tmp" added to the environment of the 7z processes, overriding the inherited ones.
+	// The outcome of a command is told by English messages ("Everything is Ok", "Wrong password?"),
+	// so LC_MESSAGES=C is forced by default, a setting making 7z print others breaks the error detection.
+	// Not passed to Runner.
+	Env []string
+	// Write passwords to the 7z stdin prompt instead of passing -p, keeping them out of the process list
+	PasswordViaStdin bool
+	// Keep Listing empty and only parse Entries, saves memory on huge archives
+	SkipListing bool
+	// Extract entries escaping the destination folder (like ../x or /x) with the leading
+	// ../ and / components stripped, instead of refusing with ErrUnsafePath. Only done by Extract and
+	// the methods based on it (ExtractTo, ExtractWithPassword, ExtractSafe, ...) and DryRunExtract,
+	// ExtractFiles, ExtractWithProgress, ExtractToList and ExtractMatching still refuse.
+	StripUnsafePaths bool
+
+	// Entries by path, the last one wins for duplicate paths
+	index map[string]*TEntry
+	// Temp files and folders removed by Close
+	temps []string
 }
 
-func Open(file string) (*TFile, error) {
+// Open the file and parse its listing. Without options it uses BINARY_NAME and an empty password.
+// The returned TFile is never nil. An archive with encrypted headers opened without password is no error:
+// Type is "encrypted archive", HeaderEncrypted and ErrorState are set, Entries and Listing stay empty.
+func Open(file string, opts ...Option) (*TFile, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return &TFile{File: file}, err
+	}
+	f := &TFile{File: file, Binary: o.binary, Runner: o.runner, Password: o.password, PasswordViaStdin: o.passwordViaStdin, SkipListing: o.skipListing}
+	err = o.retry(func() error {
+		return f.reload(o.ctx)
+	})
+	// Encrypted headers, or 7z told so in a way not recognized as such
+	encrypted := err == nil && f.Type == "encrypted archive" || errors.Is(err, ErrWrongPassword) && o.password == ""
+	if !encrypted || o.passwordFunc == nil {
+		return f, err
+	}
+
+	// List again with the asked password
+	if err := o.askPassword(); err != nil {
+		return f, err
+	}
+	f.Password = o.password
+	return f, f.reload(o.ctx)
+}
+
+// Open the file, killing any running 7z process once ctx is done
+func OpenContext(ctx context.Context, file string) (*TFile, error) {
+	return Open(file, WithContext(ctx))
+}
+
+// Open an archive read from r (like an upload) without a temp file, piping it to 7z -si.
+// The format (7z type, like "tar") must be given as it can not be detected from a stream.
+// Listing stays empty and the methods needing the archive file (extract, test, ...) can not be used.
+// Not all formats can be read from a stream (zip and 7z need seeking), 7z rejections are returned as error.
+func OpenReader(r io.Reader, format string, opts ...Option) (*TFile, error) {
+
 	f := &TFile{}
-	err := f.getInfo(file)
-	return f, err
+	o, err := newOptions(opts)
+	if err != nil {
+		return f, err
+	}
+	f.Binary = o.binary
+	f.Runner = o.runner
+	f.Password = o.password
+
+	// 7z l -slt -p -si -ttar
+	data, err := f.runInput(o.ctx, r, "l", "-slt", "-p"+f.Password, "-si", "-t"+format)
+	if o.ctx.Err() != nil {
+		return f, o.ctx.Err()
+	}
+	if err := f.listError(data, err); err != nil {
+		return f, fmt.Errorf("reading %s from a stream: %w", format, err)
+	}
+	if f.Type == "encrypted archive" {
+		return f, nil
+	}
+	return f, f.parseInfo(data)
+}
+
+// Open the file without populating Listing, only the parsed Entries
+func OpenWithoutListing(file string) (*TFile, error) {
+	return Open(file, WithoutListing())
+}
+
+// Open the file using the password for the listing, so archives with encrypted headers
+// get their Entries populated when the password is correct
+func OpenWithPassword(file string, password string) (*TFile, error) {
+	return Open(file, WithPassword(password))
+}
+
+// Open the file using the first line of passwordFile as password, see WithPasswordFile
+func OpenWithPasswordFile(file string, passwordFile string) (*TFile, error) {
+	return Open(file, WithPasswordFile(passwordFile))
+}
+
+// Open the file using the given 7z binary instead of BINARY_NAME
+func OpenWithBinary(file string, binary string) (*TFile, error) {
+	return Open(file, WithBinary(binary))
+}
+
+// The archive type 7z detected from the content, regardless of the file extension:
+// a .zip file which is actually a 7z archive reports "7z".
+// Returns the empty string and sets ErrorState if nothing was detected (like for encrypted headers).
+func (f *TFile) DetectedType() string {
+	if f.Header != nil {
+		if t := f.Header.Data["Type"]; t != "" {
+			return t
+		}
+	}
+	f.ErrorState = "archive type not detected"
+	return ""
+}
+
+// Remove the temp files and folders the operations on f left behind. Implements io.Closer.
+// f stays usable afterwards.
+func (f *TFile) Close() error {
+	var errs []error
+	for _, temp := range f.temps {
+		if err := os.RemoveAll(temp); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	f.temps = nil
+	return errors.Join(errs...)
+}
+
+// The 7z binary used by this file: Binary, or BINARY_NAME if not set.
+// With BINARY_NAME left at its default, the binary found by ResolveBinary.
+func (f *TFile) binary() string {
+	if f.Binary != "" {
+		return f.Binary
+	}
+	if BINARY_NAME == defaultBinary {
+		if binary, err := ResolveBinary(); err == nil {
+			return binary
+		}
+	}
+	return BINARY_NAME
 }
 
 type TCursor struct {
@@ -92,84 +338,180 @@ func (c *TCursor) Next() {
 	}
 }
 
-func (f *TFile) getListing() error {
+// Column titles and rule of the "7z l" table
+const (
+	listingTitles = "   Date      Time    Attr         Size   Compressed  Name"
+	listingRule   = "------------------- ----- ------------ ------------  ------------------------"
+)
 
-	output, err := exec.Command(BINARY_NAME, "l", "-p", f.File).CombinedOutput()
-	data := string(output)
-	if err != nil {
-		f.ErrorState = data
-		return err
-	}
+// Build Listing from the parsed header and entries the way "7z l" prints them,
+// instead of running 7z a second time
+func (f *TFile) getListing() {
 
-	var lines []string
-	scanner := bufio.NewScanner(strings.NewReader(data))
-	for scanner.Scan() {
-		line := scanner.Text()
-		lines = append(lines, line)
+	var b strings.Builder
+	for _, line := range f.Header.lines {
+		b.WriteString(line + "\n")
 	}
-	err = scanner.Err()
-	if err != nil {
-		return err
+	b.WriteString("\n" + listingTitles + "\n" + listingRule + "\n")
+
+	var latest time.Time
+	var last string
+	for _, entry := range f.Entries {
+		if entry.Modified.After(latest) {
+			latest = entry.Modified
+			last = entry.Data["Modified"]
+		}
+		b.WriteString(listingRow(entry.Data["Modified"], entry.attrLetters(), entry.Data["Size"], entry.Data["Packed Size"], entry.Data["Path"]))
 	}
 
-	// Process the output
-
-	var cursor TCursor
+	files, dirs := len(f.Entries)-f.DirCount(), f.DirCount()
+	total := fmt.Sprintf("%d files", files)
+	if dirs > 0 {
+		total += fmt.Sprintf(", %d folders", dirs)
+	}
+	b.WriteString(listingRule + "\n")
+	b.WriteString(listingRow(last, "", strconv.FormatInt(f.TotalSize(), 10), strconv.FormatInt(f.TotalPackedSize(), 10), total))
 
-	cursor.Start()
+	f.Listing = b.String()
+}
 
-	for i := 0; i < len(lines); i++ {
+// A "7z l" table row, the timestamp cut to seconds
+func listingRow(modified, attr, size, packed, name string) string {
+	if len(modified) > len(timeLayout) {
+		modified = modified[:len(timeLayout)]
+	}
+	return fmt.Sprintf("%19s %5s %12s %12s  %s\n", modified, attr, size, packed, name)
+}
 
-		if cursor.Preamble {
-			// Check if format supported by 7z
-			if strings.HasPrefix(lines[i], "ERROR:") {
-				return errors.New(lines[i])
-			}
-			// Check if header block reached
-			if lines[i] == "--" {
-				cursor.Next()
-			}
-			continue
+// The DOS attributes as "7z l" shows them, like "D...." or "....A"
+func (e *TEntry) attrLetters() string {
+	attrs := e.Attributes()
+	letters := []byte(".....")
+	for i, set := range []bool{attrs.Directory, attrs.ReadOnly, attrs.Hidden, attrs.System, attrs.Archive} {
+		if set {
+			letters[i] = "DRHSA"[i]
 		}
+	}
+	if e.IsDir() {
+		letters[0] = 'D'
+	}
+	return string(letters)
+}
 
-		if cursor.Header {
-			f.Listing += lines[i] + "\n"
-			if lines[i] == "" {
-				cursor.Next()
-			}
-			continue
-		}
+func (f *TFile) getInfo(ctx context.Context, file string) error {
+
+	f.File = file
+
+	args, stdin := f.withPassword(f.Password, "l", "-slt", f.File)
+	data, err := f.runInput(ctx, stdin, args...)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err := f.listError(data, err); err != nil {
+		return err
+	}
+	// Nothing to parse without the password
+	if f.Type == "encrypted archive" {
+		return nil
+	}
+
+	if err := f.parseInfo(data); err != nil {
+		return err
+	}
 
-		f.Listing += lines[i] + "\n"
+	// Listed with the password, find out whether it was needed for the names too
+	if f.Encrypted && f.Password != "" && slices.Contains(headerEncryptionTypes, f.Type) {
+		f.HeaderEncrypted = f.listNeedsPassword(ctx)
+	}
 
+	if f.SkipListing {
+		return nil
 	}
+
+	f.getListing()
+
 	return nil
 }
 
-func (f *TFile) getInfo(file string) error {
+// Archive types able to encrypt their headers (7z -mhe, rar -hp)
+var headerEncryptionTypes = []string{"7z", "Rar", "Rar5"}
 
-	f.File = file
+// Check if listing the archive without password fails as encrypted. Leaves the TFile state untouched.
+func (f *TFile) listNeedsPassword(ctx context.Context) bool {
+	stdout, stderr, _ := f.runSplit(ctx, nil, "l", "-p", f.File)
+	return strings.Contains(string(stdout)+string(stderr), "Can not open encrypted archive")
+}
 
-	output, err := exec.Command(BINARY_NAME, "l", "-slt", "-p", f.File).CombinedOutput()
-	data := string(output)
-	if err != nil {
+// The error of a listing run: err when 7z could not run, a MultiError with the exit code
+// when 7z printed ERROR lines (with a non-zero exit code, they come on stderr), else
+// the exit error. Sets ErrorState to the whole output on error. An archive with encrypted
+// headers listed without password is no error, it gets the "encrypted archive" Type.
+func (f *TFile) listError(data string, err error) error {
+
+	if err != nil && exitCode(err) == 0 {
 		f.ErrorState = data
 		return err
 	}
+	errs := f.errorLines(data)
+	for _, line := range errs {
+		// Check special occasion with full encription, 7z exits with ExitFatal
+		// "ERROR: <file name> : Can not open encrypted archive. Wrong password?"
+		// With a password given it is just wrong
+		if strings.Contains(line, "encrypted archive") && f.Password == "" {
+			f.Type = "encrypted archive"
+			f.Encrypted = true
+			f.HeaderEncrypted = true
+			f.ErrorState = "encrypted archive, the entries can not be listed without the password"
+			return nil
+		}
+	}
+	if len(errs) > 0 {
+		f.ErrorState = data
+		return newMultiError(exitCode(err), errs)
+	}
+	if err != nil {
+		f.ErrorState = data
+		return exitError(err, data)
+	}
+	return nil
+}
+
+// The ERROR lines of a 7z output: all of the ones in f.Stderr and, in stdout, the ones before
+// the "--" opening the header block (later ones could be parts of file names)
+func (f *TFile) errorLines(data string) []string {
 
-	var lines []string
-	scanner := bufio.NewScanner(strings.NewReader(data))
-	for scanner.Scan() {
-		line := scanner.Text()
-		lines = append(lines, line)
+	var errs []string
+	stdout, _ := strings.CutSuffix(data, f.Stderr)
+	lines, _ := splitLines(stdout)
+	for _, line := range lines {
+		if line == "--" {
+			break
+		}
+		if strings.HasPrefix(line, "ERROR:") {
+			errs = append(errs, line)
+		}
 	}
-	if err := scanner.Err(); err != nil {
+	lines, _ = splitLines(f.Stderr)
+	for _, line := range lines {
+		if strings.HasPrefix(line, "ERROR:") {
+			errs = append(errs, line)
+		}
+	}
+	return errs
+}
+
+// Parse the "l -slt" output into Type, Header and Entries
+func (f *TFile) parseInfo(data string) error {
+
+	lines, err := splitLines(data)
+	if err != nil {
 		return err
 	}
 
 	// Process the output
 
 	f.Header = newHeader()
+	f.index = make(map[string]*TEntry)
 	entry := newEntry()
 
 	var cursor TCursor
@@ -179,17 +521,6 @@ func (f *TFile) getInfo(file string) error {
 	for i := 0; i < len(lines); i++ {
 
 		if cursor.Preamble {
-			// Check if format supported by 7z
-			if strings.HasPrefix(lines[i], "ERROR:") {
-				// Check special occasion with full encription
-				// "ERROR: <file name> : Can not open encrypted archive. Wrong password?""
-				if strings.Contains(lines[i], "encrypted archive") {
-					f.Type = "encrypted archive"
-					f.Encrypted = true
-					return nil
-				}
-				return errors.New(lines[i])
-			}
 			// Check if header block reached
 			if lines[i] == "--" {
 				cursor.Next()
@@ -211,7 +542,7 @@ func (f *TFile) getInfo(file string) error {
 				if lines[i] == "----------" {
 					// Exit if Type not found
 					if f.Type == "" {
-						return errors.New("not supported? error: no Type found")
+						return fmt.Errorf("no Type found: %w", ErrUnsupportedFormat)
 					}
 					cursor.Next()
 				} else {
@@ -229,16 +560,15 @@ func (f *TFile) getInfo(file string) error {
 					f.Encrypted = true
 				}
 			}
-			entry.addKey(lines[i])
+			entry.addLine(lines[i])
 		} else {
 			f.Entries = append(f.Entries, entry)
+			f.index[entry.Data["Path"]] = entry
 			entry = newEntry()
 		}
 	}
 
-	err = f.getListing()
-
-	return err
+	return nil
 }
 
 // Test a password against the file. Return false if any error
@@ -248,22 +578,14 @@ func (f *TFile) TestPassword(password string) bool {
 		return false
 	}
 
-	password = "-p" + password
-
-	output, err := exec.Command(BINARY_NAME, "t", "-bd", password, f.File).CombinedOutput()
-	data := string(output)
+	args, stdin := f.withPassword(password, "t", "-bd", f.File)
+	data, err := f.runInput(context.Background(), stdin, args...)
 	if err != nil {
 		f.ErrorState = data
 		return false
 	}
 
-	var lines []string
-	scanner := bufio.NewScanner(strings.NewReader(data))
-	for scanner.Scan() {
-		line := scanner.Text()
-		lines = append(lines, line)
-	}
-	err = scanner.Err()
+	lines, err := splitLines(data)
 	if err != nil {
 		return false
 	}
@@ -279,34 +601,254 @@ func (f *TFile) TestPassword(password string) bool {
 	return false
 }
 
-// Unpack file to specified folder. Returns the whole cmd stdout if error.
+// Test the integrity of the whole archive (use empty password if not set), verifying CRCs.
+// Works on non-encrypted archives too. Returns the whole cmd stdout if error.
+func (f *TFile) Test(password string) error {
+
+	// 7z t -bd -p ./zip.zip
+	args, stdin := f.withPassword(password, "t", "-bd", f.File)
+	return f.executeInput(context.Background(), stdin, args...)
+}
+
+// Test the integrity of a single entry (use empty password if not set). In solid archives
+// 7z still has to decompress the part of the block before it. Returns the whole cmd stdout if error.
+func (f *TFile) TestFile(name string, password string) error {
+
+	// 7z "No files to process" is Ok as well
+	if !f.hasEntry(name) {
+		return errors.New("not found in archive: " + name)
+	}
+
+	// 7z t -bd -p -spd -- ./zip.zip name
+	args, stdin := f.withPassword(password, "t", "-bd", "-spd", "--", f.File, name)
+	return f.executeInput(context.Background(), stdin, args...)
+}
+
+// Unpack file to specified folder, with the password it was opened with. Returns the whole cmd stdout if error.
 func (f *TFile) ExtractTo(folder string) error {
-	return f.ExtractWithPassword(folder, "")
+	return f.ExtractToContext(context.Background(), folder)
+}
+
+// Same as ExtractTo, but the 7z process is killed once ctx is done
+func (f *TFile) ExtractToContext(ctx context.Context, folder string) error {
+	return f.ExtractWithPasswordContext(ctx, folder, "")
 }
 
-// Unpack file to specified folder (use empty password if not set). Returns the whole cmd stdout if error.
+// Unpack file to specified folder (use f.Password if empty). Returns the whole cmd stdout if error.
 func (f *TFile) ExtractWithPassword(folder string, password string) error {
+	return f.ExtractWithPasswordContext(context.Background(), folder, password)
+}
 
-	// 7z x -bd -aoa -p -o./test ./zip.zip
-	output, _ := exec.Command(BINARY_NAME, "x", "-aoa", "-bd", "-p"+password, "-o"+folder, f.File).CombinedOutput()
-	data := string(output)
+// Same as ExtractWithPassword, but the 7z process is killed once ctx is done.
+// Returns ctx.Err() rather than the truncated stdout if cancelled.
+func (f *TFile) ExtractWithPasswordContext(ctx context.Context, folder string, password string) error {
+	return f.Extract(folder, WithContext(ctx), WithPassword(password))
+}
 
-	var lines []string
+// Unpack file to specified folder, configured by options like WithPassword (f.Password if not set,
+// WithPasswordFunc is only asked without either), WithContext, WithOverwriteMode (OverwriteAll if not set)
+// and WithStripComponents. Returns the whole cmd stdout if error.
+func (f *TFile) Extract(folder string, opts ...Option) error {
 
-	scanner := bufio.NewScanner(strings.NewReader(data))
-	for scanner.Scan() {
-		line := scanner.Text()
-		lines = append(lines, line)
+	o, err := f.extractOptions(opts)
+	if err != nil {
+		return err
 	}
-	err := scanner.Err()
+
+	return o.retry(func() error {
+		return f.extract(folder, o)
+	})
+}
+
+// Check the options of an extract command, its password falling back to f.Password,
+// then to WithPasswordFunc for an encrypted archive
+func (f *TFile) extractOptions(opts []Option) (*options, error) {
+	o, err := newOptions(opts)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
+	}
+	if err := f.checkOptions(o); err != nil {
+		return nil, err
+	}
+	if o.password == "" {
+		o.password = f.Password
 	}
+	if f.Encrypted {
+		if err := o.askPassword(); err != nil {
+			return nil, err
+		}
+	}
+	return o, nil
+}
 
-	for _, line := range lines {
-		if line == "Everything is Ok" {
-			return nil
+// Extract with checked options
+func (f *TFile) extract(folder string, o *options) error {
+
+	if unsafe := f.unsafeEntries(); len(unsafe) > 0 {
+		if !f.StripUnsafePaths {
+			return unsafeError(unsafe)
+		}
+		if o.stripComponents > 0 {
+			return fmt.Errorf("%d entries with unsafe paths to strip, can not strip components as well: %w", len(unsafe), ErrUnsafePath)
 		}
+		return f.extractStripped(folder, o, unsafe)
 	}
-	return errors.New(data)
+
+	if o.stripComponents > 0 {
+		return f.extractComponents(folder, o)
+	}
+
+	// 7z x -bd -aoa -p -o./test ./zip.zip
+	args, stdin := f.withPassword(o.password, "x", string(o.overwrite), "-bd", "-o"+folder, f.File)
+	args = append(args, o.switches()...)
+	return f.executeInput(o.ctx, stdin, args...)
+}
+
+// Unpack only the named entries to specified folder (use empty password if not set).
+// Returns an error listing the names absent from the archive, or the whole cmd stdout if error.
+func (f *TFile) ExtractFiles(folder string, names []string, password string) error {
+
+	if len(names) == 0 {
+		return errors.New("no files to extract")
+	}
+
+	var missing []string
+	for _, name := range names {
+		if !f.hasEntry(name) {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return errors.New("not found in archive: " + strings.Join(missing, ", "))
+	}
+
+	var unsafe []*TEntry
+	for _, entry := range f.unsafeEntries() {
+		if slices.Contains(names, entry.Data["Path"]) {
+			unsafe = append(unsafe, entry)
+		}
+	}
+	if len(unsafe) > 0 {
+		return unsafeError(unsafe)
+	}
+
+	// Names from the archive are no wildcards (-spd), switches or list files (--)
+	args, stdin := f.withPassword(password, "x", "-aoa", "-bd", "-o"+folder, "-spd", "--", f.File)
+	args = append(args, names...)
+	return f.executeInput(context.Background(), stdin, args...)
+}
+
+// Unpack the entries at the given indexes of f.Entries, see ExtractFiles. 7z only takes names,
+// so duplicate paths (tar) extract all the entries sharing them. Returns an error listing
+// the indexes out of range.
+func (f *TFile) ExtractIndexes(folder string, indexes []int, password string) error {
+
+	var names []string
+	var invalid []string
+	for _, i := range indexes {
+		if i < 0 || i >= len(f.Entries) {
+			invalid = append(invalid, strconv.Itoa(i))
+			continue
+		}
+		names = append(names, f.Entries[i].Data["Path"])
+	}
+	if len(invalid) > 0 {
+		return fmt.Errorf("indexes out of range [0, %d): %s", len(f.Entries), strings.Join(invalid, ", "))
+	}
+
+	return f.ExtractFiles(folder, names, password)
+}
+
+// Stream a single entry's contents. Close must be called to release the 7z process,
+// closing before EOF kills it.
+func (f *TFile) OpenEntry(name string, password string) (io.ReadCloser, error) {
+
+	if !f.hasEntry(name) {
+		return nil, errors.New("not found in archive: " + name)
+	}
+
+	ctx, cancel := f.withTimeout(context.Background())
+	args, stdin := f.withPassword(password, "x", "-so", "-bd", "-spd", "--", f.File, name)
+	cmd := f.command(ctx, args...)
+	cmd.Stdin = stdin
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return nil, binaryError(err, f.binary())
+	}
+	return &entryReader{f: f, stdout: stdout, stderr: &stderr, cmd: cmd, ctx: ctx, cancel: cancel}, nil
+}
+
+type entryReader struct {
+	f      *TFile
+	stdout io.ReadCloser
+	stderr *bytes.Buffer
+	cmd    *exec.Cmd
+	ctx    context.Context
+	cancel context.CancelFunc
+	eof    bool
+	closed bool
+}
+
+func (r *entryReader) Read(p []byte) (int, error) {
+	n, err := r.stdout.Read(p)
+	if err == io.EOF {
+		r.eof = true
+	}
+	return n, err
+}
+
+func (r *entryReader) Close() error {
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	if !r.eof {
+		// Closed early, the process is killed and its exit status is of no interest
+		r.cancel()
+		r.cmd.Wait()
+		return nil
+	}
+	err := r.f.timeoutError(context.Background(), r.ctx, r.cmd.Wait())
+	r.cancel()
+	if errors.Is(err, ErrTimeout) {
+		return err
+	}
+	if err != nil {
+		return exitError(err, r.stderr.String())
+	}
+	return nil
+}
+
+// Read the archive again after it changed on disk, replacing Type, Header, Entries and Listing
+// instead of adding to them. Add, Delete, Rename and Update do it themselves.
+func (f *TFile) Refresh() error {
+	return f.reload(context.Background())
+}
+
+// Reset the parsed state and read the archive again
+func (f *TFile) reload(ctx context.Context) error {
+	f.Type = ""
+	f.Listing = ""
+	f.Header = nil
+	f.Entries = nil
+	f.index = nil
+	f.Encrypted = false
+	f.HeaderEncrypted = false
+	f.ErrorState = ""
+	f.Stderr = ""
+	f.LastOutput = ""
+	return f.getInfo(ctx, f.File)
+}
+
+// Check if an entry with the given path exists
+func (f *TFile) hasEntry(name string) bool {
+	_, ok := f.Entry(name)
+	return ok
 }
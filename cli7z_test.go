@@ -0,0 +1,420 @@
+package cli7z
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Runner answering each 7z command (its args and stdin) with canned output
+type runnerFunc func(args []string, stdin string) (stdout, stderr string, err error)
+
+func (r runnerFunc) Run(ctx context.Context, stdin io.Reader, name string, args ...string) ([]byte, []byte, error) {
+	var input []byte
+	if stdin != nil {
+		input, _ = io.ReadAll(stdin)
+	}
+	stdout, stderr, err := r(args, string(input))
+	return []byte(stdout), []byte(stderr), err
+}
+
+// Output of 7zz l -slt before the archive block
+const preamble = "\n7-Zip (z) 23.01 (x64) : Copyright (c) 1999-2023 Igor Pavlov : 2023-06-20\n\n" +
+	"Scanning the drive for archives:\n1 file, 226 bytes (1 KiB)\n\nListing archive: a.7z\n\n"
+
+// Stderr of 7zz l on an archive with encrypted headers, with a missing or wrong password
+const encryptedStderr = "ERROR: a.7z : Can not open encrypted archive. Wrong password?\n\nErrors: 1\n"
+
+func TestOpenHeaderEncryptedWithoutPassword(t *testing.T) {
+	runner := runnerFunc(func(args []string, stdin string) (string, string, error) {
+		return preamble, encryptedStderr, &ExitError{Code: ExitFatal}
+	})
+
+	f, err := Open("a.7z", WithRunner(runner))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if f.Type != "encrypted archive" || !f.Encrypted || !f.HeaderEncrypted {
+		t.Errorf("Type %q, Encrypted %v, HeaderEncrypted %v", f.Type, f.Encrypted, f.HeaderEncrypted)
+	}
+	if f.ErrorState == "" {
+		t.Error("ErrorState not set")
+	}
+	if len(f.Entries) != 0 || f.Listing != "" {
+		t.Errorf("%d entries, listing %q", len(f.Entries), f.Listing)
+	}
+}
+
+func TestOpenHeaderEncryptedWrongPassword(t *testing.T) {
+	runner := runnerFunc(func(args []string, stdin string) (string, string, error) {
+		return preamble, encryptedStderr, &ExitError{Code: ExitFatal}
+	})
+
+	f, err := Open("a.7z", WithRunner(runner), WithPassword("wrong"))
+	if !errors.Is(err, ErrWrongPassword) {
+		t.Fatalf("Open: %v, want ErrWrongPassword", err)
+	}
+	var multi *MultiError
+	if !errors.As(err, &multi) || multi.Code != ExitFatal {
+		t.Errorf("Open: %#v, want a MultiError with code %d", err, ExitFatal)
+	}
+	if f == nil || f.Type != "" {
+		t.Errorf("TFile %+v", f)
+	}
+}
+
+func TestOpenPasswordFunc(t *testing.T) {
+	runner := runnerFunc(func(args []string, stdin string) (string, string, error) {
+		if !slices.Contains(args, "-psecret") {
+			return preamble, encryptedStderr, &ExitError{Code: ExitFatal}
+		}
+		return preamble + "--\nPath = a.7z\nType = 7z\n\n----------\nPath = a.txt\nSize = 3\nEncrypted = +\n\n", "", nil
+	})
+	asked := 0
+	ask := func() (string, error) {
+		asked++
+		return "secret", nil
+	}
+
+	f, err := Open("a.7z", WithRunner(runner), WithPasswordFunc(ask))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if asked != 1 {
+		t.Errorf("password asked %d times, want 1", asked)
+	}
+	if f.Password != "secret" || f.Type != "7z" || len(f.Entries) != 1 || !f.HeaderEncrypted {
+		t.Errorf("Password %q, Type %q, %d entries, HeaderEncrypted %v", f.Password, f.Type, len(f.Entries), f.HeaderEncrypted)
+	}
+}
+
+func TestOpenPasswordFuncError(t *testing.T) {
+	runner := runnerFunc(func(args []string, stdin string) (string, string, error) {
+		return preamble, encryptedStderr, &ExitError{Code: ExitFatal}
+	})
+	canceled := errors.New("canceled by user")
+	ask := func() (string, error) {
+		return "", canceled
+	}
+
+	if _, err := Open("a.7z", WithRunner(runner), WithPasswordFunc(ask)); !errors.Is(err, canceled) {
+		t.Fatalf("Open: %v, want the password func error", err)
+	}
+}
+
+func TestOpenPasswordFuncWrongPassword(t *testing.T) {
+	runner := runnerFunc(func(args []string, stdin string) (string, string, error) {
+		if !slices.Contains(args, "-psecret") {
+			return preamble, "ERROR: Wrong password : a.rar\n", &ExitError{Code: ExitFatal}
+		}
+		return preamble + "--\nPath = a.rar\nType = Rar5\n\n----------\n", "", nil
+	})
+	ask := func() (string, error) {
+		return "secret", nil
+	}
+
+	f, err := Open("a.rar", WithRunner(runner), WithPasswordFunc(ask))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if f.Type != "Rar5" {
+		t.Errorf("Type %q, want Rar5", f.Type)
+	}
+}
+
+func TestExtractFilesNamesAfterDoubleDash(t *testing.T) {
+	var got []string
+	runner := runnerFunc(func(args []string, stdin string) (string, string, error) {
+		if args[0] == "l" {
+			return preamble + "--\nPath = a.7z\nType = 7z\n\n----------\nPath = -o/tmp/x\nSize = 1\n\nPath = *\nSize = 1\n\n", "", nil
+		}
+		got = args
+		return "Everything is Ok\n", "", nil
+	})
+
+	f, err := Open("a.7z", WithRunner(runner))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if err := f.ExtractFiles("out", []string{"-o/tmp/x", "*"}, ""); err != nil {
+		t.Fatalf("ExtractFiles: %v", err)
+	}
+
+	dash := slices.Index(got, "--")
+	if dash < 0 || !slices.Contains(got, "-spd") {
+		t.Fatalf("args %q, want -spd and --", got)
+	}
+	if !slices.Equal(got[dash+1:], []string{"a.7z", "-o/tmp/x", "*"}) {
+		t.Errorf("args after -- %q", got[dash+1:])
+	}
+}
+
+func TestCreatePasswordViaStdin(t *testing.T) {
+	var got []string
+	var input string
+	runner := runnerFunc(func(args []string, stdin string) (string, string, error) {
+		got, input = args, stdin
+		return "Everything is Ok\n", "", nil
+	})
+
+	err := Create("a.7z", []string{"a.txt"}, WithRunner(runner), WithPassword("secret"), WithPasswordViaStdin())
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if slices.Contains(got, "-psecret") || !slices.Contains(got, "-p") {
+		t.Errorf("args %q, want a bare -p", got)
+	}
+	if input != "secret\nsecret\n" {
+		t.Errorf("stdin %q, want the password and its confirmation", input)
+	}
+}
+
+// Answer 7z l with the archive block followed by the given entry blocks
+func listRunner(got *[]string, entries string) runnerFunc {
+	return func(args []string, stdin string) (string, string, error) {
+		*got = args
+		return preamble + "--\nPath = a.7z\nType = 7z\n\n----------\n" + entries, "", nil
+	}
+}
+
+func TestOpenNameWithSeparator(t *testing.T) {
+	var args []string
+	f, err := Open("a.7z", WithRunner(listRunner(&args, "Path = a = b.txt\nSize = 3\n\n")))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if len(f.Entries) != 1 || f.Entries[0].Data["Path"] != "a = b.txt" || f.Entries[0].Size != 3 {
+		t.Fatalf("entries %+v", f.Entries)
+	}
+}
+
+func TestOpenNameWithNewline(t *testing.T) {
+	var args []string
+	f, err := Open("a.7z", WithRunner(listRunner(&args, "Path = a\nb.txt\nSize = 3\n\nPath = c.txt\nSize = 1\n\n")))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if len(f.Entries) != 2 || f.Entries[0].Data["Path"] != "a\nb.txt" || f.Entries[0].Size != 3 {
+		t.Fatalf("entries %+v", f.Entries)
+	}
+	if f.Entries[1].Data["Path"] != "c.txt" {
+		t.Errorf("second entry %q", f.Entries[1].Data["Path"])
+	}
+}
+
+func TestOpenAccentedName(t *testing.T) {
+	var args []string
+	f, err := Open("a.7z", WithRunner(listRunner(&args, "Path = café/naïve résumé.txt\nSize = 3\n\n")))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if len(f.Entries) != 1 || f.Entries[0].Data["Path"] != "café/naïve résumé.txt" {
+		t.Fatalf("entries %+v", f.Entries)
+	}
+	if runtime.GOOS != "windows" && (len(args) < 2 || args[0] != "l" || args[1] != "-sccUTF-8") {
+		t.Errorf("args %q, want -sccUTF-8 after the command", args)
+	}
+}
+
+func TestNativeCharset(t *testing.T) {
+	f := &TFile{NativeCharset: true}
+	if args := f.commandArgs([]string{"l", "a.7z"}); slices.Contains(args, "-sccUTF-8") {
+		t.Errorf("args %q, want no -sccUTF-8", args)
+	}
+}
+
+func TestOpenCRLF(t *testing.T) {
+	runner := runnerFunc(func(args []string, stdin string) (string, string, error) {
+		out := preamble + "--\nPath = a.zip\nType = zip\n\n----------\nPath = a.txt\nSize = 3\n\n"
+		return strings.ReplaceAll(out, "\n", "\r\n"), "", nil
+	})
+
+	f, err := Open("a.zip", WithRunner(runner))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if f.Type != "zip" {
+		t.Errorf("Type %q, want zip", f.Type)
+	}
+	if len(f.Entries) != 1 || f.Entries[0].Data["Path"] != "a.txt" || f.Entries[0].Size != 3 {
+		t.Fatalf("entries %+v", f.Entries)
+	}
+}
+
+func TestEnglishEnv(t *testing.T) {
+	env := englishEnv([]string{"LANG=de_DE.UTF-8", "LC_ALL=de_DE.UTF-8", "LC_CTYPE=C", "HOME=/root"})
+
+	want := []string{"LANG=de_DE.UTF-8", "LC_CTYPE=C", "HOME=/root", "LC_CTYPE=de_DE.UTF-8", "LC_MESSAGES=C"}
+	if !slices.Equal(env, want) {
+		t.Errorf("env %q, want %q", env, want)
+	}
+}
+
+func TestCommandEnv(t *testing.T) {
+	t.Setenv("LC_ALL", "ja_JP.UTF-8")
+	f := &TFile{Env: []string{"TZ=UTC"}}
+
+	env := f.newCmd(context.Background(), "7zz", "l").Env
+	if slices.ContainsFunc(env, func(v string) bool { return strings.HasPrefix(v, "LC_ALL=") }) {
+		t.Errorf("env %q holds LC_ALL", env)
+	}
+	if len(env) < 2 || env[len(env)-2] != "LC_MESSAGES=C" || env[len(env)-1] != "TZ=UTC" {
+		t.Errorf("env %q, want LC_MESSAGES=C followed by Env", env)
+	}
+}
+
+func TestExtractWithLimitsUnknownSize(t *testing.T) {
+	var args []string
+	f, err := Open("a.bz2", WithRunner(listRunner(&args, "Path = a\nSize = \nPacked Size = 10\n\n")))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	if err := f.ExtractWithLimits("out", "", 10); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("ExtractWithLimits: %v, want ErrTooLarge", err)
+	}
+	if args[0] != "l" {
+		t.Errorf("7z %s run", args[0])
+	}
+}
+
+func TestExtractWithLimitsEncryptedHeaders(t *testing.T) {
+	runner := runnerFunc(func(args []string, stdin string) (string, string, error) {
+		if args[0] != "l" {
+			t.Errorf("7z %s run", args[0])
+		}
+		return preamble, encryptedStderr, &ExitError{Code: ExitFatal}
+	})
+	f, err := Open("a.7z", WithRunner(runner))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	if err := f.ExtractWithLimits("out", "", 10); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("ExtractWithLimits: %v, want ErrTooLarge", err)
+	}
+}
+
+func TestDeleteRunError(t *testing.T) {
+	var args []string
+	f, err := Open("a.7z", WithRunner(listRunner(&args, "Path = a.txt\nSize = 3\n\n")))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	f.Runner = runnerFunc(func(args []string, stdin string) (string, string, error) {
+		return "", "", binaryError(exec.ErrNotFound, "7zz")
+	})
+
+	if err := f.Delete([]string{"a.txt"}); !errors.Is(err, ErrBinaryNotFound) {
+		t.Errorf("Delete: %v, want ErrBinaryNotFound", err)
+	}
+}
+
+func TestExtractOpenedPassword(t *testing.T) {
+	var got []string
+	runner := runnerFunc(func(args []string, stdin string) (string, string, error) {
+		if args[0] == "l" {
+			return preamble + "--\nPath = a.7z\nType = 7z\n\n----------\nPath = a.txt\nSize = 3\nEncrypted = +\n\n", "", nil
+		}
+		got = args
+		return "Everything is Ok\n", "", nil
+	})
+	f, err := Open("a.7z", WithRunner(runner), WithPassword("secret"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	ask := func() (string, error) {
+		t.Error("password asked again")
+		return "", nil
+	}
+
+	if err := f.Extract("out", WithPasswordFunc(ask)); err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+	if !slices.Contains(got, "-psecret") {
+		t.Errorf("args %q, want -psecret", got)
+	}
+}
+
+func TestExtractMatchingOptions(t *testing.T) {
+	attempts := 0
+	runner := runnerFunc(func(args []string, stdin string) (string, string, error) {
+		if args[0] == "l" {
+			return preamble + "--\nPath = a.7z\nType = 7z\n\n----------\nPath = a.txt\nSize = 3\nEncrypted = +\n\n", "", nil
+		}
+		attempts++
+		if stdin != "secret\n" {
+			t.Errorf("attempt %d stdin %q", attempts, stdin)
+		}
+		return "", "ERROR: a.txt : Read error\n", &ExitError{Code: ExitFatal}
+	})
+	f, err := Open("a.7z", WithRunner(runner))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	f.PasswordViaStdin = true
+	ask := func() (string, error) {
+		return "secret", nil
+	}
+
+	err = f.ExtractMatching("out", "", []string{"*.txt"}, nil, WithPasswordFunc(ask), WithRetry(2, 0))
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) || attempts != 2 {
+		t.Errorf("ExtractMatching: %v after %d attempts, want an *ExitError after 2", err, attempts)
+	}
+	if err := f.ExtractMatching("out", "", nil, nil, WithStripComponents(1)); err == nil {
+		t.Error("ExtractMatching with WithStripComponents: no error")
+	}
+	if err := f.ExtractFlat("out", "", WithStripComponents(1)); err == nil {
+		t.Error("ExtractFlat with WithStripComponents: no error")
+	}
+}
+
+func TestMatchesAny(t *testing.T) {
+	f := &TFile{}
+	for _, name := range []string{"a/dir/x.txt", "b/[draft] y.md"} {
+		f.Entries = append(f.Entries, &TEntry{Data: map[string]string{"Path": name}})
+	}
+
+	tests := []struct {
+		pattern string
+		want    bool
+	}{
+		{"*.txt", true},
+		{"x.txt", true},
+		{"dir/*.txt", true},
+		{`dir\x.txt`, true},
+		{"a/dir/x.txt", true},
+		{"ir/x.txt", false},
+		{"b/dir/*.txt", false},
+		{"[draft]*", true},
+		{"[d]*", false},
+		{"*.go", false},
+	}
+	for _, test := range tests {
+		if got := f.matchesAny(test.pattern); got != test.want {
+			t.Errorf("matchesAny(%q) = %v, want %v", test.pattern, got, test.want)
+		}
+	}
+}
+
+func TestOpenZipWithPasswordListsOnce(t *testing.T) {
+	runs := 0
+	runner := runnerFunc(func(args []string, stdin string) (string, string, error) {
+		runs++
+		return preamble + "--\nPath = a.zip\nType = zip\n\n----------\nPath = a.txt\nSize = 3\nEncrypted = +\n\n", "", nil
+	})
+
+	f, err := Open("a.zip", WithRunner(runner), WithPassword("secret"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if runs != 1 || f.HeaderEncrypted {
+		t.Errorf("%d 7z runs, HeaderEncrypted %v, want 1 run", runs, f.HeaderEncrypted)
+	}
+}
@@ -0,0 +1,406 @@
+package cli7z
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Archive formats 7z can create, by file extension
+var formatByExtension = map[string]string{
+	".7z":  "7z",
+	".zip": "zip",
+	".tar": "tar",
+	".gz":  "gzip",
+	".tgz": "gzip",
+	".bz2": "bzip2",
+	".xz":  "xz",
+	".wim": "wim",
+}
+
+// Extension 7z adds to an archive name without one, by format
+var extensionByFormat = map[string]string{
+	"7z":    ".7z",
+	"zip":   ".zip",
+	"tar":   ".tar",
+	"gzip":  ".gz",
+	"bzip2": ".bz2",
+	"xz":    ".xz",
+	"wim":   ".wim",
+}
+
+// Pack inputs into a new archive. The format is chosen by the archive extension unless WithFormat is given.
+// Returns the whole cmd stdout if error.
+func Create(archivePath string, inputs []string, opts ...Option) error {
+
+	if len(inputs) == 0 {
+		return errors.New("no files to add")
+	}
+
+	o, err := newOptions(opts)
+	if err != nil {
+		return err
+	}
+	f := &TFile{File: archivePath, Binary: o.binary, Runner: o.runner}
+	if err := f.checkOptions(o); err != nil {
+		return err
+	}
+
+	format := o.format
+	if format == "" {
+		format = formatByExtension[strings.ToLower(filepath.Ext(archivePath))]
+	}
+
+	// 7z a -bd -tzip ./zip.zip ./file1 ./file2
+	args := []string{"a", "-bd"}
+	if format != "" {
+		args = append(args, "-t"+format)
+	}
+	if o.volumeSize != "" {
+		args = append(args, "-v"+o.volumeSize)
+	}
+	if o.sfx {
+		if format != "" && format != "7z" {
+			return fmt.Errorf("self-extracting archives not supported for format %q, only 7z", format)
+		}
+		if o.volumeSize != "" {
+			return errors.New("self-extracting archives can not be split")
+		}
+		args = append(args, "-sfx"+o.sfxModule)
+	}
+	args = append(args, o.switches()...)
+	if o.level >= 0 {
+		args = append(args, "-mx="+strconv.Itoa(o.level))
+	}
+	if o.method != "" {
+		// 7z is the default format of 7z a
+		checked := format
+		if checked == "" {
+			checked = "7z"
+		}
+		switch {
+		case !slices.Contains(methodsByFormat[checked], o.method):
+			return fmt.Errorf("compression method %s not supported for format %q", o.method, format)
+		case format == "zip":
+			args = append(args, "-mm="+o.method)
+		default:
+			args = append(args, "-m0="+o.method)
+		}
+	}
+	if o.comment != "" {
+		if format != "zip" {
+			return fmt.Errorf("comments not supported for format %q, only zip", format)
+		}
+		if o.volumeSize != "" {
+			return errors.New("comments not supported for split archives")
+		}
+	}
+	var stdin io.Reader
+	switch {
+	case o.password != "" && o.passwordViaStdin:
+		// A bare -p makes 7z a prompt for the password, then for its confirmation
+		args = append(args, "-p")
+		stdin = strings.NewReader(o.password + "\n" + o.password + "\n")
+	case o.password != "":
+		args = append(args, "-p"+o.password)
+	}
+	if o.encryptHdrs {
+		if o.password == "" {
+			return errors.New("encrypted headers need a password")
+		}
+		if format != "" && format != "7z" {
+			return fmt.Errorf("encrypted headers not supported for format %q", format)
+		}
+		args = append(args, "-mhe=on")
+	}
+	args = append(args, archivePath)
+	args = append(args, inputs...)
+	if err := f.executeInput(o.ctx, stdin, args...); err != nil {
+		return err
+	}
+	if o.comment != "" {
+		return setZipComment(archivePath, o.comment)
+	}
+	return nil
+}
+
+// Write the comment in the end of central directory record closing a zip file:
+// signature PK\x05\x06, 16 bytes of fields, the 2 bytes comment length and the comment itself
+func setZipComment(file string, comment string) error {
+
+	zf, err := os.OpenFile(file, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer zf.Close()
+
+	info, err := zf.Stat()
+	if err != nil {
+		return err
+	}
+	// The record is 22 bytes plus a comment of up to 0xFFFF bytes
+	size := info.Size()
+	tailSize := min(size, 22+0xFFFF)
+	tail := make([]byte, tailSize)
+	if _, err := zf.ReadAt(tail, size-tailSize); err != nil {
+		return err
+	}
+
+	for i := len(tail) - 22; i >= 0; i-- {
+		if !bytes.Equal(tail[i:i+4], []byte("PK\x05\x06")) {
+			continue
+		}
+		if i+22+int(binary.LittleEndian.Uint16(tail[i+20:])) != len(tail) {
+			continue
+		}
+		offset := size - tailSize + int64(i)
+		if err := zf.Truncate(offset + 22); err != nil {
+			return err
+		}
+		length := make([]byte, 2)
+		binary.LittleEndian.PutUint16(length, uint16(len(comment)))
+		if _, err := zf.WriteAt(length, offset+20); err != nil {
+			return err
+		}
+		_, err := zf.WriteAt([]byte(comment), offset+22)
+		return err
+	}
+	return errors.New("no zip end of central directory record found in " + file)
+}
+
+// Repack src into a new archive at destPath, like zip to 7z: src is extracted with password
+// to a temp folder which is then packed by Create with opts (format by extension, WithPassword
+// to encrypt the new archive, ...). The temp folder is removed in any case, and so is destPath
+// if packing fails. destPath must not exist, 7z would add to it.
+func Convert(src *TFile, destPath string, password string, opts ...Option) error {
+
+	if fileExists(destPath) {
+		return errors.New("destination exists: " + destPath)
+	}
+
+	temp, err := os.MkdirTemp("", "cli7z-convert-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(temp)
+
+	if err := src.ExtractWithPassword(temp, password); err != nil {
+		return err
+	}
+
+	// 7z stores the names relative to the wildcard folder
+	if err := Create(destPath, []string{filepath.Join(temp, "*")}, opts...); err != nil {
+		os.Remove(destPath)
+		return err
+	}
+	return nil
+}
+
+// Pack inputs into a new self-extracting archive with the stub module (default one if empty),
+// see WithSFX. Returns the path of the executable: archivePath, or archivePath.exe when 7z added
+// the extension (depending on the platform, for a name without one).
+func CreateSFX(archivePath string, inputs []string, module string, opts ...Option) (string, error) {
+	if err := Create(archivePath, inputs, append(opts, WithSFX(module))...); err != nil {
+		return "", err
+	}
+	candidates := []string{archivePath, archivePath + ".exe"}
+	if filepath.Ext(archivePath) == "" {
+		candidates = []string{archivePath + ".exe", archivePath}
+	}
+	for _, candidate := range candidates {
+		if fileExists(candidate) {
+			return candidate, nil
+		}
+	}
+	return "", errors.New("self-extracting archive not found after 7z: " + archivePath)
+}
+
+// Pack inputs into a new archive split in volumes of the size given by WithVolumeSize.
+// Returns the names of the generated volumes (archivePath.001, archivePath.002, ...). Like 7z,
+// a name without extension gets the one of the format first ("backup" makes backup.7z.001, ...).
+func CreateVolumes(archivePath string, inputs []string, opts ...Option) ([]string, error) {
+
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	if o.volumeSize == "" {
+		return nil, errors.New("no volume size set")
+	}
+
+	if err := Create(archivePath, inputs, opts...); err != nil {
+		return nil, err
+	}
+
+	if filepath.Ext(archivePath) == "" {
+		format := o.format
+		if format == "" {
+			format = "7z"
+		}
+		archivePath += extensionByFormat[format]
+	}
+
+	name := volumeNamer(archivePath + ".001")
+	var volumes []string
+	for i := 1; fileExists(name(i, 0)); i++ {
+		volumes = append(volumes, name(i, 0))
+	}
+	if len(volumes) == 0 {
+		return nil, errors.New("no volume found after 7z: " + archivePath + ".001")
+	}
+	return volumes, nil
+}
+
+// Append files to the opened archive and re-read it. Returns the whole cmd stdout if error.
+func (f *TFile) Add(paths []string) error {
+
+	if len(paths) == 0 {
+		return errors.New("no files to add")
+	}
+
+	args := []string{"a", "-bd", f.File}
+	args = append(args, paths...)
+	if err := f.execute(context.Background(), args...); err != nil {
+		return err
+	}
+	return f.reload(context.Background())
+}
+
+// Remove entries from the opened archive and re-read it.
+// Names absent from the archive and 7z warnings are returned as an error.
+func (f *TFile) Delete(names []string) error {
+
+	if len(names) == 0 {
+		return errors.New("no files to delete")
+	}
+
+	var missing []string
+	for _, name := range names {
+		if !f.hasEntry(name) {
+			missing = append(missing, name)
+		}
+	}
+
+	ctx := context.Background()
+
+	// 7z d -bd -spd -- ./zip.zip file1 file2
+	args := []string{"d", "-bd", "-spd", "--", f.File}
+	args = append(args, names...)
+	data, runErr := f.run(ctx, args...)
+
+	lines, err := splitLines(data)
+	if err != nil {
+		return err
+	}
+
+	var warnings []string
+	succeed := false
+	for _, line := range lines {
+		if strings.HasPrefix(line, "WARNING") {
+			warnings = append(warnings, line)
+		}
+		if line == "Everything is Ok" {
+			succeed = true
+		}
+	}
+	if !succeed && len(warnings) == 0 {
+		if runErr != nil {
+			return exitError(runErr, data)
+		}
+		return wrapOutput(errors.New(data), data)
+	}
+
+	if err := f.reload(ctx); err != nil {
+		return err
+	}
+
+	if len(missing) > 0 {
+		warnings = append(warnings, "not found in archive: "+strings.Join(missing, ", "))
+	}
+	if len(warnings) > 0 {
+		return errors.New(strings.Join(warnings, "\n"))
+	}
+	return nil
+}
+
+// Rename entries of the opened archive, old path to new path, and re-read it.
+// Returns an error naming the old paths absent from the archive without renaming anything.
+func (f *TFile) Rename(pairs map[string]string) error {
+
+	if len(pairs) == 0 {
+		return errors.New("no files to rename")
+	}
+
+	olds := make([]string, 0, len(pairs))
+	for old := range pairs {
+		olds = append(olds, old)
+	}
+	sort.Strings(olds)
+
+	var missing []string
+	for _, old := range olds {
+		if !f.hasEntry(old) {
+			missing = append(missing, old)
+		}
+	}
+	if len(missing) > 0 {
+		return errors.New("not found in archive: " + strings.Join(missing, ", "))
+	}
+
+	// 7z rn -bd -spd -- ./zip.zip old1 new1 old2 new2
+	args := []string{"rn", "-bd", "-spd", "--", f.File}
+	for _, old := range olds {
+		args = append(args, old, pairs[old])
+	}
+	ctx := context.Background()
+	if err := f.execute(ctx, args...); err != nil {
+		return err
+	}
+	return f.reload(ctx)
+}
+
+// Add the files of paths that are new or changed since packed into the opened archive (7z u),
+// the primitive for incremental backups, and re-read it.
+// Returns how many entries were added and updated, found by comparing the listings.
+func (f *TFile) Update(paths []string) (added int, updated int, err error) {
+
+	if len(paths) == 0 {
+		return 0, 0, errors.New("no files to update")
+	}
+
+	before := make(map[string]*TEntry, len(f.Entries))
+	for _, entry := range f.Entries {
+		before[entry.Data["Path"]] = entry
+	}
+
+	// 7z u -bd ./zip.zip ./file1 ./file2
+	args := []string{"u", "-bd", f.File}
+	args = append(args, paths...)
+	ctx := context.Background()
+	if err := f.execute(ctx, args...); err != nil {
+		return 0, 0, err
+	}
+	if err := f.reload(ctx); err != nil {
+		return 0, 0, err
+	}
+
+	for _, entry := range f.Entries {
+		old, ok := before[entry.Data["Path"]]
+		switch {
+		case !ok:
+			added++
+		case old.Size != entry.Size || old.CRC != entry.CRC || !old.Modified.Equal(entry.Modified):
+			updated++
+		}
+	}
+	return added, updated, nil
+}
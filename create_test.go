@@ -0,0 +1,53 @@
+package cli7z
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSetZipComment(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "a.zip")
+	out, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := zip.NewWriter(out)
+	if err := w.SetComment("old comment to replace"); err != nil {
+		t.Fatal(err)
+	}
+	fw, err := w.Create("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write([]byte("abc"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	out.Close()
+
+	for _, comment := range []string{"new comment", ""} {
+		if err := setZipComment(file, comment); err != nil {
+			t.Fatalf("setZipComment(%q): %v", comment, err)
+		}
+		r, err := zip.OpenReader(file)
+		if err != nil {
+			t.Fatalf("reading back %q: %v", comment, err)
+		}
+		if r.Comment != comment || len(r.File) != 1 || r.File[0].Name != "a.txt" {
+			t.Errorf("comment %q, %d files, want %q", r.Comment, len(r.File), comment)
+		}
+		r.Close()
+	}
+}
+
+func TestSetZipCommentNotZip(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "a.zip")
+	if err := os.WriteFile(file, []byte("not a zip archive at all"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := setZipComment(file, "x"); err == nil {
+		t.Error("no error for a file without end record")
+	}
+}
@@ -0,0 +1,35 @@
+package cli7z
+
+import (
+	"encoding/csv"
+	"io"
+	"time"
+)
+
+// Write the entries as CSV with a header row: path, size, packed size, modified, CRC, attributes.
+// Fields the entry lacks are left blank.
+func (f *TFile) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"path", "size", "packed size", "modified", "CRC", "attributes"}); err != nil {
+		return err
+	}
+	for _, entry := range f.Entries {
+		modified := ""
+		if !entry.Modified.IsZero() {
+			modified = entry.Modified.Format(time.DateTime)
+		}
+		record := []string{
+			entry.Data["Path"],
+			entry.Data["Size"],
+			entry.Data["Packed Size"],
+			modified,
+			entry.CRC,
+			entry.Data["Attributes"],
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
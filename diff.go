@@ -0,0 +1,72 @@
+package cli7z
+
+import (
+	"errors"
+	"sort"
+)
+
+// Kind of difference between two archives
+type DiffKind int
+
+const (
+	// Only in the second archive
+	DiffAdded DiffKind = iota
+	// Only in the first archive
+	DiffRemoved
+	// In both, with a different size or CRC
+	DiffChanged
+)
+
+// A path differing between two archives. A or B is nil for added and removed entries.
+type DiffEntry struct {
+	Path string
+	Kind DiffKind
+	A    *TEntry
+	B    *TEntry
+}
+
+// Compare the entries of two opened archives, matched by Name (\ and / separators alike).
+// Entries are changed when their sizes differ, or their CRCs when both have one (tar has none).
+// Returns the differences sorted by path, none if both hold the same contents.
+func Diff(a, b *TFile) ([]DiffEntry, error) {
+
+	if a == nil || b == nil {
+		return nil, errors.New("nil archive")
+	}
+	if a.Type == "encrypted archive" || b.Type == "encrypted archive" {
+		return nil, errors.New("entries of an encrypted archive not listed, open it with the password")
+	}
+
+	entriesA := entriesByName(a)
+	entriesB := entriesByName(b)
+
+	var diff []DiffEntry
+	for name, entryA := range entriesA {
+		entryB, ok := entriesB[name]
+		switch {
+		case !ok:
+			diff = append(diff, DiffEntry{Path: name, Kind: DiffRemoved, A: entryA})
+		case entryA.Size != entryB.Size || (entryA.HasCRC() && entryB.HasCRC() && entryA.CRC != entryB.CRC):
+			diff = append(diff, DiffEntry{Path: name, Kind: DiffChanged, A: entryA, B: entryB})
+		}
+	}
+	for name, entryB := range entriesB {
+		if _, ok := entriesA[name]; !ok {
+			diff = append(diff, DiffEntry{Path: name, Kind: DiffAdded, B: entryB})
+		}
+	}
+
+	sort.Slice(diff, func(i, j int) bool {
+		return diff[i].Path < diff[j].Path
+	})
+	return diff, nil
+}
+
+// Entries by Name, the last one wins for duplicate paths
+func entriesByName(f *TFile) map[string]*TEntry {
+	entries := make(map[string]*TEntry, len(f.Entries))
+	for _, entry := range f.Entries {
+		entries[entry.Name()] = entry
+	}
+	return entries
+}
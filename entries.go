@@ -0,0 +1,342 @@
+package cli7z
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Look up an entry by its path. If the archive holds several entries with the same path
+// (possible in tar), the last one wins, see EntriesByPath to get all of them.
+func (f *TFile) Entry(path string) (*TEntry, bool) {
+	entry, ok := f.index[path]
+	return entry, ok
+}
+
+// All the entries with the given path, in archive order
+func (f *TFile) EntriesByPath(path string) []*TEntry {
+	var entries []*TEntry
+	for _, entry := range f.Entries {
+		if entry.Data["Path"] == path {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// Sum of the unpacked sizes of all entries
+func (f *TFile) TotalSize() int64 {
+	var total int64
+	for _, entry := range f.Entries {
+		total += entry.Size
+	}
+	return total
+}
+
+// Sum of the packed sizes of all entries
+func (f *TFile) TotalPackedSize() int64 {
+	var total int64
+	for _, entry := range f.Entries {
+		total += entry.PackedSize
+	}
+	return total
+}
+
+// Packed to unpacked size of all entries, like 0.34 for "compressed to 34%", 0 if nothing unpacked.
+// Above 1 when packing made them bigger.
+func (f *TFile) OverallRatio() float64 {
+	size := f.TotalSize()
+	if size == 0 {
+		return 0
+	}
+	return float64(f.TotalPackedSize()) / float64(size)
+}
+
+// Packed to unpacked size of the entry, 0 for empty files and directories. In solid archives
+// the packed size of a whole block goes to its first entry, the others report 0.
+func (e *TEntry) Ratio() float64 {
+	if e.Size == 0 {
+		return 0
+	}
+	return float64(e.PackedSize) / float64(e.Size)
+}
+
+// Number of entries, files and directories
+func (f *TFile) EntryCount() int {
+	return len(f.Entries)
+}
+
+// Footer of "7z l": "... 12 files, 3 folders" (either part may be missing)
+var countRegexp = regexp.MustCompile(`(?:(\d+) files?)?(?:, )?(?:(\d+) folders?)?$`)
+
+// Count the entries (files and directories) of the archive at file path from the footer of
+// the plain listing, much cheaper than Open on huge archives. Takes WithBinary, WithRunner and WithContext.
+func EntryCount(file string, opts ...Option) (int, error) {
+
+	o, err := newOptions(opts)
+	if err != nil {
+		return 0, err
+	}
+	f := &TFile{File: file, Binary: o.binary, Runner: o.runner}
+	data, err := f.run(o.ctx, "l", "-p", file)
+	if err != nil {
+		return 0, exitError(err, data)
+	}
+
+	lines, err := splitLines(data)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := len(lines) - 1; i >= 0; i-- {
+		match := countRegexp.FindStringSubmatch(strings.TrimSpace(lines[i]))
+		if match == nil || (match[1] == "" && match[2] == "") {
+			continue
+		}
+		files, _ := strconv.Atoi(match[1])
+		folders, _ := strconv.Atoi(match[2])
+		return files + folders, nil
+	}
+	return 0, errors.New("no entry count found: " + data)
+}
+
+// Number of directory entries
+func (f *TFile) DirCount() int {
+	count := 0
+	for _, entry := range f.Entries {
+		if entry.IsDir() {
+			count++
+		}
+	}
+	return count
+}
+
+// Check if the entry is a directory, by either the "Folder = +" or the "Attributes = D..." marker.
+// Entries with neither marker are files.
+func (e *TEntry) IsDir() bool {
+	return e.Data["Folder"] == "+" || strings.HasPrefix(e.Data["Attributes"], "D")
+}
+
+// The entry path with \ separators (archives made on Windows) turned into /.
+// Purely cosmetic, for display and matching, Data["Path"] keeps the raw value.
+func (e *TEntry) Name() string {
+	return strings.ReplaceAll(e.Data["Path"], `\`, "/")
+}
+
+// Check if the entry has a CRC, directories and empty files have none
+func (e *TEntry) HasCRC() bool {
+	return e.CRC != ""
+}
+
+// Check if the entry itself is encrypted ("Encrypted = +"), in zip archives only some may be
+func (e *TEntry) Encrypted() bool {
+	return e.Data["Encrypted"] == "+"
+}
+
+// DOS attributes of an entry
+type Attrs struct {
+	Directory bool
+	ReadOnly  bool
+	Hidden    bool
+	System    bool
+	Archive   bool
+}
+
+// Parse the DOS attribute letters of "Attributes = ", like "....A", "D...." or "A_ -rw-r--r--"
+// (the unix mode suffix is ignored)
+func (e *TEntry) Attributes() Attrs {
+	letters, _, _ := strings.Cut(e.Data["Attributes"], " ")
+	return Attrs{
+		Directory: strings.Contains(letters, "D"),
+		ReadOnly:  strings.Contains(letters, "R"),
+		Hidden:    strings.Contains(letters, "H"),
+		System:    strings.Contains(letters, "S"),
+		Archive:   strings.Contains(letters, "A"),
+	}
+}
+
+// The file entries, in archive order
+func (f *TFile) Files() []*TEntry {
+	var files []*TEntry
+	for _, entry := range f.Entries {
+		if !entry.IsDir() {
+			files = append(files, entry)
+		}
+	}
+	return files
+}
+
+// The directory entries, in archive order
+func (f *TFile) Dirs() []*TEntry {
+	var dirs []*TEntry
+	for _, entry := range f.Entries {
+		if entry.IsDir() {
+			dirs = append(dirs, entry)
+		}
+	}
+	return dirs
+}
+
+// Same as Files, the entries with neither the "Folder = +" nor the "Attributes = D..." marker
+func (f *TFile) OnlyFiles() []*TEntry {
+	return f.Files()
+}
+
+// Same as Dirs, the entries with the "Folder = +" or the "Attributes = D..." marker
+func (f *TFile) OnlyDirs() []*TEntry {
+	return f.Dirs()
+}
+
+// The entries under the directory prefix (matched on Name, "" for the root), in archive order.
+// Without recursive only its immediate children. Directories with no entry of their own
+// (only implied by the paths under them) are not returned.
+func (f *TFile) Children(prefix string, recursive bool) []*TEntry {
+	prefix = strings.Trim(strings.ReplaceAll(prefix, `\`, "/"), "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	var children []*TEntry
+	for _, entry := range f.Entries {
+		rest, ok := strings.CutPrefix(strings.TrimSuffix(entry.Name(), "/"), prefix)
+		if !ok || rest == "" {
+			continue
+		}
+		if recursive || !strings.Contains(rest, "/") {
+			children = append(children, entry)
+		}
+	}
+	return children
+}
+
+// Call fn for each entry, directories included, in order, stopping at and returning
+// the first error fn returns
+func (f *TFile) Walk(fn func(*TEntry) error) error {
+	for _, entry := range f.Entries {
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Entry field to sort by
+type SortKey int
+
+const (
+	SortByName SortKey = iota
+	SortBySize
+	SortByPackedSize
+	SortByModified
+)
+
+// Reorder f.Entries in place by key, ascending or descending. Sizes and times compare
+// as numbers, not strings. Entries with equal keys keep their relative order.
+func (f *TFile) SortBy(key SortKey, desc bool) {
+	less := func(a, b *TEntry) bool {
+		switch key {
+		case SortBySize:
+			return a.Size < b.Size
+		case SortByPackedSize:
+			return a.PackedSize < b.PackedSize
+		case SortByModified:
+			return a.Modified.Before(b.Modified)
+		}
+		return a.Data["Path"] < b.Data["Path"]
+	}
+	sort.SliceStable(f.Entries, func(i, j int) bool {
+		if desc {
+			return less(f.Entries[j], f.Entries[i])
+		}
+		return less(f.Entries[i], f.Entries[j])
+	})
+}
+
+// Stream the entries of the archive at file path one at a time, see (*TFile).ForEachEntry
+func ForEachEntry(ctx context.Context, file string, fn func(*TEntry) error) error {
+	f := &TFile{File: file}
+	return f.ForEachEntry(ctx, fn)
+}
+
+// Parse the entries of f.File on the fly and call fn for each of them, without holding them all in memory.
+// f does not need to be opened and f.Entries is left untouched.
+// Returning an error from fn stops the iteration, kills the 7z process and returns that error.
+func (f *TFile) ForEachEntry(parent context.Context, fn func(*TEntry) error) error {
+
+	ctx, cancel := f.withTimeout(parent)
+	defer cancel()
+
+	args, stdin := f.withPassword(f.Password, "l", "-slt", f.File)
+	cmd := f.command(ctx, args...)
+	cmd.Stdin = stdin
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return binaryError(err, f.binary())
+	}
+
+	// Stop the 7z process and return err
+	stop := func(err error) error {
+		cancel()
+		cmd.Wait()
+		return err
+	}
+
+	var cursor TCursor
+
+	cursor.Start()
+
+	entry := newEntry()
+	scanner := newScanner(stdout)
+	for scanner.Scan() {
+		line := trimLine(scanner.Text())
+
+		if cursor.Preamble {
+			if strings.HasPrefix(line, "ERROR:") {
+				return stop(wrapOutput(errors.New(line), line))
+			}
+			if line == "--" {
+				cursor.Next()
+			}
+			continue
+		}
+
+		if cursor.Header {
+			if line == "----------" {
+				cursor.Next()
+			}
+			continue
+		}
+
+		if line != "" {
+			entry.addLine(line)
+			continue
+		}
+		if len(entry.Data) == 0 {
+			continue
+		}
+		if err := fn(entry); err != nil {
+			return stop(err)
+		}
+		entry = newEntry()
+	}
+	if err := scanner.Err(); err != nil {
+		return stop(fmt.Errorf("reading 7z output: %w", err))
+	}
+
+	if err := cmd.Wait(); err != nil {
+		if parent.Err() != nil {
+			return parent.Err()
+		}
+		return exitError(f.timeoutError(parent, ctx, err), stderr.String())
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package cli7z
+
+import "testing"
+
+func TestEntryCount(t *testing.T) {
+	tests := []struct {
+		footer string
+		want   int
+	}{
+		{"2023-06-20 10:00:00                 1234          567  12 files, 3 folders", 15},
+		{"2023-06-20 10:00:00                    3            3  1 file", 1},
+		{"2023-06-20 10:00:00                    0            0  3 folders", 3},
+	}
+	for _, test := range tests {
+		output := preamble + "   Date      Time    Attr         Size   Compressed  Name\n" +
+			"------------------- ----- ------------ ------------  ------------------------\n" +
+			"2023-06-20 10:00:00 ....A            3            3  a.txt\n" +
+			"------------------- ----- ------------ ------------  ------------------------\n" +
+			test.footer + "\n"
+		got, err := EntryCount("a.7z", WithRunner(outputRunner(output)))
+		if err != nil {
+			t.Errorf("EntryCount of %q: %v", test.footer, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("EntryCount of %q = %d, want %d", test.footer, got, test.want)
+		}
+	}
+
+	if _, err := EntryCount("a.7z", WithRunner(outputRunner(preamble))); err == nil {
+		t.Error("EntryCount without footer: no error")
+	}
+}
@@ -0,0 +1,161 @@
+package cli7z
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"strings"
+)
+
+var (
+	ErrWrongPassword     = errors.New("wrong password")
+	ErrUnsupportedFormat = errors.New("unsupported format")
+	ErrNotAnArchive      = errors.New("not an archive")
+	ErrTooLarge          = errors.New("archive too large")
+	ErrUnsafePath        = errors.New("entry path outside destination folder")
+	ErrMissingVolume     = errors.New("missing volume")
+	ErrBinaryNotFound    = errors.New("7z binary not found")
+	ErrTimeout           = errors.New("7z timed out")
+	ErrInsufficientSpace = errors.New("insufficient disk space")
+)
+
+// Errors a retry will not fix
+var permanentErrors = []error{
+	ErrWrongPassword, ErrUnsupportedFormat, ErrNotAnArchive, ErrTooLarge, ErrUnsafePath,
+	ErrMissingVolume, ErrBinaryNotFound, ErrTimeout, ErrInsufficientSpace,
+	context.Canceled, context.DeadlineExceeded,
+}
+
+// Check if err may be transient, like an I/O error on a network filesystem: neither one of
+// the sentinel errors or a cancelled context, nor an exit code other than ExitFatal
+func retryable(err error) bool {
+	for _, permanent := range permanentErrors {
+		if errors.Is(err, permanent) {
+			return false
+		}
+	}
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code == ExitFatal
+	}
+	return true
+}
+
+// Find the sentinel error matching a 7z message, nil if none
+func classify(output string) error {
+	switch {
+	case strings.Contains(output, "Wrong password"):
+		return ErrWrongPassword
+	case strings.Contains(output, "Can not open the file as archive"), strings.Contains(output, "Is not archive"):
+		return ErrNotAnArchive
+	case strings.Contains(output, "Unsupported"):
+		return ErrUnsupportedFormat
+	}
+	return nil
+}
+
+// Wrap err with the sentinel error matching the 7z output, if any
+func wrapOutput(err error, output string) error {
+	sentinel := classify(output)
+	if sentinel == nil {
+		return err
+	}
+	return fmt.Errorf("%v: %w", err, sentinel)
+}
+
+// MultiError holds every ERROR line 7z reported, e.g. for each missing part of a multi-volume archive
+type MultiError struct {
+	// 7z exit code, see the Exit* constants
+	Code  int
+	lines []string
+}
+
+func newMultiError(code int, lines []string) error {
+	return &MultiError{Code: code, lines: lines}
+}
+
+func (e *MultiError) Error() string {
+	return strings.Join(e.lines, "\n")
+}
+
+// The ERROR lines in output order
+func (e *MultiError) Errors() []string {
+	return e.lines
+}
+
+// The sentinel errors matching the lines, so errors.Is works on a MultiError
+func (e *MultiError) Unwrap() []error {
+	var errs []error
+	for _, line := range e.lines {
+		if sentinel := classify(line); sentinel != nil {
+			errs = append(errs, sentinel)
+		}
+	}
+	return errs
+}
+
+// 7z exit codes
+const (
+	ExitWarning     = 1
+	ExitFatal       = 2
+	ExitCommandLine = 7
+	ExitMemory      = 8
+	ExitUserStopped = 255
+)
+
+// ExitError is a 7z run ending with a non-zero exit code, see the Exit* constants
+type ExitError struct {
+	Code   int
+	Output string
+}
+
+func (e *ExitError) Error() string {
+	if e.Output == "" {
+		return fmt.Sprintf("7z exit code %d", e.Code)
+	}
+	return e.Output
+}
+
+// The sentinel error matching the output, if any
+func (e *ExitError) Unwrap() error {
+	return classify(e.Output)
+}
+
+// Turn a 7z run error with an exit code into an *ExitError carrying the output,
+// other errors (like a missing binary) are returned as is
+func exitError(err error, output string) error {
+	var execErr *exec.ExitError
+	if errors.As(err, &execErr) {
+		return &ExitError{Code: execErr.ExitCode(), Output: output}
+	}
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return &ExitError{Code: exitErr.Code, Output: output}
+	}
+	return err
+}
+
+// The 7z exit code of err, 0 if it is no exit error (like a binary which could not run)
+func exitCode(err error) int {
+	var execErr *exec.ExitError
+	if errors.As(err, &execErr) {
+		return execErr.ExitCode()
+	}
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code
+	}
+	return 0
+}
+
+// Wrap the error of a 7z binary which can not be started with ErrBinaryNotFound and an install hint
+// (not found in PATH, or a missing path). Other start errors, like a missing WorkDir, are returned as is.
+func binaryError(err error, binary string) error {
+	var pathErr *fs.PathError
+	if errors.Is(err, exec.ErrNotFound) || errors.As(err, &pathErr) && pathErr.Path == binary && errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%s: %w (install 7-Zip or set BINARY_NAME): %v", binary, ErrBinaryNotFound, err)
+	}
+	return err
+}
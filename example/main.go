@@ -11,6 +11,9 @@ func main() {
 	file, err := cli7z.Open("./file.zip")
 	if err != nil {
 		fmt.Println(err)
+		return
+	}
+	if file.HeaderEncrypted {
 		fmt.Println(file.ErrorState)
 		return
 	}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/nghtf/cli7z"
+)
+
+// Extract 50 archives in parallel with a pool of 8 workers.
+// Every goroutine works on its own TFile, which is what makes this safe.
+func main() {
+
+	var archives []string
+	for i := 0; i < 50; i++ {
+		archives = append(archives, "./file.zip")
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				file, err := cli7z.Open(archives[i])
+				if err != nil {
+					fmt.Println(archives[i], err)
+					continue
+				}
+				folder := filepath.Join(os.TempDir(), "cli7z", strconv.Itoa(i))
+				if err := file.ExtractTo(folder); err != nil {
+					fmt.Println(archives[i], err)
+					continue
+				}
+				fmt.Println(archives[i], "->", folder)
+			}
+		}()
+	}
+
+	for i := range archives {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
@@ -0,0 +1,494 @@
+package cli7z
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Progress lines of -bsp1 look like "  5% 3 - file.txt", redrawn with backspaces
+var progressRegexp = regexp.MustCompile(`(\d+)%`)
+
+// Unpack file to specified folder, calling cb with the percentage as it advances:
+// at least once per percent and a final time with 100 on success. A nil cb behaves like ExtractWithPassword.
+func (f *TFile) ExtractWithProgress(folder string, password string, cb func(percent int)) error {
+
+	if cb == nil {
+		return f.ExtractWithPassword(folder, password)
+	}
+
+	if unsafe := f.unsafeEntries(); len(unsafe) > 0 {
+		return unsafeError(unsafe)
+	}
+
+	ctx, cancel := f.withTimeout(context.Background())
+	defer cancel()
+
+	// 7z x -bd -aoa -bsp1 -p -o./test ./zip.zip
+	args, stdin := f.withPassword(password, "x", "-aoa", "-bsp1", "-o"+folder, f.File)
+	cmd := f.command(ctx, args...)
+	cmd.Stdin = stdin
+	var output, stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return binaryError(err, f.binary())
+	}
+
+	f.Warnings = nil
+
+	percent := 0
+	scanner := bufio.NewScanner(io.TeeReader(stdout, &output))
+	scanner.Split(scanProgress)
+	for scanner.Scan() {
+		match := progressRegexp.FindStringSubmatch(scanner.Text())
+		if match == nil {
+			continue
+		}
+		current, _ := strconv.Atoi(match[1])
+		for percent < current && percent < 99 {
+			percent++
+			cb(percent)
+		}
+	}
+	scanErr := scanner.Err()
+	waitErr := f.timeoutError(context.Background(), ctx, cmd.Wait())
+	if errors.Is(waitErr, ErrTimeout) {
+		return waitErr
+	}
+	if scanErr != nil {
+		return scanErr
+	}
+
+	f.Stderr = stderr.String()
+	data := output.String() + f.Stderr
+	f.setLastOutput(data)
+	lines, err := splitLines(data)
+	if err != nil {
+		return err
+	}
+	f.collectWarnings(lines)
+	if !strings.Contains(data, "Everything is Ok") {
+		if waitErr != nil {
+			if err := f.allowWarnings(exitError(waitErr, data)); err != nil {
+				return err
+			}
+			cb(100)
+			return nil
+		}
+		return wrapOutput(errors.New(data), data)
+	}
+	cb(100)
+	return nil
+}
+
+// Unpack file to w (use empty password if not set), without a temp folder.
+// For a single file archive (like .gz) w gets the raw content, for multi-file archives
+// 7z writes the contents of all files one after another with nothing to tell them apart.
+// Returns the cmd stderr if error.
+func (f *TFile) ExtractToWriter(w io.Writer, password string) error {
+
+	// 7z x -so -bd -p ./file.gz
+	ctx, cancel := f.withTimeout(context.Background())
+	defer cancel()
+	args, stdin := f.withPassword(password, "x", "-so", "-bd", f.File)
+	cmd := f.command(ctx, args...)
+	cmd.Stdin = stdin
+	cmd.Stdout = w
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	f.Warnings = nil
+	err := f.timeoutError(context.Background(), ctx, cmd.Run())
+	f.Stderr = stderr.String()
+	f.setLastOutput(f.Stderr)
+	if lines, err := splitLines(f.Stderr); err == nil {
+		f.collectWarnings(lines)
+	}
+	if err != nil {
+		return exitError(binaryError(err, f.binary()), f.Stderr)
+	}
+	return nil
+}
+
+// Unpack every file straight into folder, discarding the directory structure (7z e).
+// Files with the same name in different archive directories collide: with the default
+// OverwriteAll the last one in archive order wins, WithOverwriteMode picks another behavior
+// (like RenameExtracted to keep all of them). Other options are the ones of Extract, but for
+// WithStripComponents returning an error as there are no directories to strip.
+func (f *TFile) ExtractFlat(folder string, password string, opts ...Option) error {
+
+	o, err := f.extractOptions(append([]Option{WithPassword(password)}, opts...))
+	if err != nil {
+		return err
+	}
+	if o.stripComponents > 0 {
+		return errors.New("strip components not supported by ExtractFlat")
+	}
+
+	// The stdin of the password is read by each attempt
+	return o.retry(func() error {
+		// 7z e -bd -aoa -p -o./test ./zip.zip
+		args, stdin := f.withPassword(o.password, "e", string(o.overwrite), "-bd", "-o"+folder, f.File)
+		args = append(args, o.switches()...)
+		return f.executeInput(o.ctx, stdin, args...)
+	})
+}
+
+// Unpack file to specified folder like ExtractWithPassword, returning the paths
+// (joined with folder) of the files 7z reports as written. Directories are left out.
+func (f *TFile) ExtractToList(folder string, password string) ([]string, error) {
+
+	if unsafe := f.unsafeEntries(); len(unsafe) > 0 {
+		return nil, unsafeError(unsafe)
+	}
+
+	// 7z x -bd -bb1 -aoa -p -o./test ./zip.zip, printing "- <path>" for each item
+	args, stdin := f.withPassword(password, "x", "-aoa", "-bd", "-bb1", "-o"+folder, f.File)
+	lines, err := f.executeOutput(context.Background(), stdin, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, line := range lines {
+		name, found := strings.CutPrefix(line, "- ")
+		if !found {
+			continue
+		}
+		if entry, ok := f.Entry(name); ok && entry.IsDir() {
+			continue
+		}
+		files = append(files, filepath.Join(folder, filepath.FromSlash(name)))
+	}
+	return files, nil
+}
+
+// Unpack the entries matching any include pattern (all if none) and no exclude pattern
+// (7z -ir! and -xr! switches). Patterns use the 7z wildcards * and ? and match at any depth,
+// like *.txt or dir/*.txt, [ is no character class. Matching follows the 7z build: case
+// insensitive on Windows, case sensitive elsewhere. WithRequireMatch turns an include pattern
+// matching no entry into an error, other options are the ones of Extract but for WithStripComponents,
+// not supported here and returning an error.
+func (f *TFile) ExtractMatching(folder string, password string, include []string, exclude []string, opts ...Option) error {
+
+	o, err := f.extractOptions(append([]Option{WithPassword(password)}, opts...))
+	if err != nil {
+		return err
+	}
+	if o.stripComponents > 0 {
+		return errors.New("strip components not supported by ExtractMatching")
+	}
+
+	if o.requireMatch {
+		var unmatched []string
+		for _, pattern := range include {
+			if !f.matchesAny(pattern) {
+				unmatched = append(unmatched, pattern)
+			}
+		}
+		if len(unmatched) > 0 {
+			return errors.New("no entry matches: " + strings.Join(unmatched, ", "))
+		}
+	}
+
+	if unsafe := f.unsafeEntries(); len(unsafe) > 0 {
+		return unsafeError(unsafe)
+	}
+
+	// 7z x -bd -aoa -p -o./test -ir!*.txt -xr!tmp/* ./zip.zip
+	switches := o.switches()
+	for _, pattern := range include {
+		switches = append(switches, "-ir!"+pattern)
+	}
+	for _, pattern := range exclude {
+		switches = append(switches, "-xr!"+pattern)
+	}
+	// The stdin of the password is read by each attempt
+	return o.retry(func() error {
+		args, stdin := f.withPassword(o.password, "x", string(o.overwrite), "-bd", "-o"+folder)
+		args = append(args, switches...)
+		args = append(args, f.File)
+		return f.executeInput(o.ctx, stdin, args...)
+	})
+}
+
+// Check if a 7z wildcard pattern matches the end of any entry path, like -ir! does: "*.txt" matches
+// the file name at any depth, "dir/*.txt" also "a/dir/x.txt"
+func (f *TFile) matchesAny(pattern string) bool {
+	// 7z wildcards have no character classes, [ is a plain character
+	pattern = strings.ReplaceAll(pattern, `\`, "/")
+	pattern = strings.ReplaceAll(pattern, "[", `\[`)
+	for _, entry := range f.Entries {
+		parts := strings.Split(entry.Name(), "/")
+		for i := range parts {
+			if ok, _ := path.Match(pattern, strings.Join(parts[i:], "/")); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// List the paths (joined with folder) extracting would create, directories included, without
+// running 7z, so collisions with existing files can be checked first. Entries escaping folder
+// return ErrUnsafePath, or their stripped path with StripUnsafePaths. The listing is already
+// parsed, so password is not needed and only mirrors ExtractWithPassword.
+func (f *TFile) DryRunExtract(folder string, password string) ([]string, error) {
+
+	if unsafe := f.unsafeEntries(); len(unsafe) > 0 && !f.StripUnsafePaths {
+		return nil, unsafeError(unsafe)
+	}
+
+	var paths []string
+	for _, entry := range f.Entries {
+		name := stripPath(entry.Data["Path"])
+		if name == "" || name == "." {
+			continue
+		}
+		paths = append(paths, filepath.Join(folder, filepath.FromSlash(name)))
+	}
+	return paths, nil
+}
+
+// Highest unpacked to packed size ratio ExtractWithLimits accepts, 0 disables the check
+var MaxCompressionRatio float64 = 100
+
+// Unpack file to specified folder unless the unpacked size from the listing exceeds maxTotalBytes
+// or the compression ratio exceeds MaxCompressionRatio, both returning ErrTooLarge. Guards against zip bombs.
+// An archive whose size is unknown, a file listed without Size (like bzip2) or the entries of an
+// encrypted archive opened without the password, is refused with ErrTooLarge as well.
+func (f *TFile) ExtractWithLimits(folder string, password string, maxTotalBytes int64) error {
+
+	if f.Type == "encrypted archive" {
+		return fmt.Errorf("unpacked size unknown, entries not listed without the password: %w", ErrTooLarge)
+	}
+	for _, entry := range f.Files() {
+		if entry.Data["Size"] == "" {
+			return fmt.Errorf("unpacked size of %s unknown: %w", entry.Data["Path"], ErrTooLarge)
+		}
+	}
+
+	size := f.TotalSize()
+	packed := f.TotalPackedSize()
+
+	if size > maxTotalBytes {
+		return fmt.Errorf("%d bytes unpacked, limit is %d: %w", size, maxTotalBytes, ErrTooLarge)
+	}
+	if MaxCompressionRatio > 0 && packed > 0 {
+		ratio := float64(size) / float64(packed)
+		if ratio > MaxCompressionRatio {
+			return fmt.Errorf("compression ratio %.1f, limit is %.1f: %w", ratio, MaxCompressionRatio, ErrTooLarge)
+		}
+	}
+
+	return f.ExtractWithPassword(folder, password)
+}
+
+// Unpack file to specified folder unless the unpacked size from the listing exceeds the free space
+// of its filesystem, returning ErrInsufficientSpace instead of failing halfway. The folder may not exist yet.
+func (f *TFile) ExtractSafe(folder string, password string) error {
+
+	// The closest existing folder is on the filesystem the extracted files go to
+	dir := f.localPath(folder)
+	for !fileExists(dir) && filepath.Dir(dir) != dir {
+		dir = filepath.Dir(dir)
+	}
+	available, err := freeSpace(dir)
+	if err != nil {
+		return fmt.Errorf("free space of %s: %w", dir, err)
+	}
+
+	if size := f.TotalSize(); uint64(size) > available {
+		return fmt.Errorf("%d bytes unpacked, %d available: %w", size, available, ErrInsufficientSpace)
+	}
+
+	return f.ExtractWithPassword(folder, password)
+}
+
+// Split 7z progress output on new lines, carriage returns and backspaces
+func scanProgress(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if i := bytes.IndexAny(data, "\n\r\b"); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// Entries whose path resolves outside the destination folder
+func (f *TFile) unsafeEntries() []*TEntry {
+	var unsafe []*TEntry
+	for _, entry := range f.Entries {
+		if unsafePath(entry.Data["Path"]) {
+			unsafe = append(unsafe, entry)
+		}
+	}
+	return unsafe
+}
+
+func unsafeError(entries []*TEntry) error {
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Data["Path"])
+	}
+	return fmt.Errorf("%s: %w", strings.Join(names, ", "), ErrUnsafePath)
+}
+
+// Clean an entry path using / for both / and \ separators
+func cleanPath(p string) string {
+	return path.Clean(strings.ReplaceAll(p, `\`, "/"))
+}
+
+// Check if an entry path is absolute, has a drive letter or climbs up with ../
+func unsafePath(p string) bool {
+	clean := cleanPath(p)
+	return path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") || (len(clean) >= 2 && clean[1] == ':')
+}
+
+// Strip the drive letter, leading / and ../ components from an entry path
+func stripPath(p string) string {
+	clean := cleanPath(p)
+	if len(clean) >= 2 && clean[1] == ':' {
+		clean = clean[2:]
+	}
+	for {
+		switch {
+		case strings.HasPrefix(clean, "/"):
+			clean = clean[1:]
+		case strings.HasPrefix(clean, "../"):
+			clean = clean[3:]
+		case clean == "..":
+			return ""
+		default:
+			return clean
+		}
+	}
+}
+
+// Unpack the safe entries with 7z, then stream each unsafe one to its stripped path inside folder
+func (f *TFile) extractStripped(folder string, o *options, unsafe []*TEntry) error {
+
+	args, stdin := f.withPassword(o.password, "x", string(o.overwrite), "-bd", "-spd", "-o"+folder, f.File)
+	args = append(args, o.switches()...)
+	for _, entry := range unsafe {
+		args = append(args, "-x!"+entry.Data["Path"])
+	}
+	if err := f.executeInput(o.ctx, stdin, args...); err != nil {
+		return err
+	}
+
+	for _, entry := range unsafe {
+		name := stripPath(entry.Data["Path"])
+		if name == "" || name == "." {
+			continue
+		}
+		target := filepath.Join(f.localPath(folder), filepath.FromSlash(name))
+		if entry.IsDir() {
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+			continue
+		}
+		if o.overwrite == SkipExisting && fileExists(target) {
+			continue
+		}
+		if err := f.extractEntryTo(entry.Data["Path"], o.password, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 7z has no switch to strip path components, so the archive is unpacked to a temp folder inside
+// folder, then each file is renamed to its stripped path. Being on the same filesystem each rename
+// is atomic, but the whole extraction is not: a failure leaves the files moved so far in folder.
+// SkipExisting keeps files already in folder, other overwrite modes replace them.
+// The temp folder is removed on return, or by Close if that failed.
+func (f *TFile) extractComponents(folder string, o *options) error {
+
+	// Absolute, so 7z running in WorkDir and the file operations here agree
+	folder, err := filepath.Abs(f.localPath(folder))
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(folder, 0o755); err != nil {
+		return err
+	}
+	temp, err := os.MkdirTemp(folder, ".cli7z-")
+	if err != nil {
+		return err
+	}
+	f.temps = append(f.temps, temp)
+	defer os.RemoveAll(temp)
+
+	args, stdin := f.withPassword(o.password, "x", "-aoa", "-bd", "-o"+temp, f.File)
+	args = append(args, o.switches()...)
+	if err := f.executeInput(o.ctx, stdin, args...); err != nil {
+		return err
+	}
+
+	return filepath.WalkDir(temp, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(temp, p)
+		if err != nil {
+			return err
+		}
+		parts := strings.Split(rel, string(filepath.Separator))
+		if rel == "." || len(parts) <= o.stripComponents {
+			return nil
+		}
+		target := filepath.Join(append([]string{folder}, parts[o.stripComponents:]...)...)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0o755)
+		}
+		if o.overwrite == SkipExisting && fileExists(target) {
+			return nil
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+		return os.Rename(p, target)
+	})
+}
+
+// Stream a single entry to the target file path
+func (f *TFile) extractEntryTo(name string, password string, target string) error {
+
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	r, err := f.OpenEntry(name, password)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	w, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return r.Close()
+}
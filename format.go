@@ -0,0 +1,33 @@
+package cli7z
+
+import (
+	"fmt"
+)
+
+// Format a byte count with binary units, like "1.5 MiB"
+func FormatBytes(n int64) string {
+	return formatBytes(n, 1024, []string{"KiB", "MiB", "GiB", "TiB", "PiB", "EiB"})
+}
+
+// Format a byte count with decimal units, like "1.5 MB"
+func FormatBytesDecimal(n int64) string {
+	return formatBytes(n, 1000, []string{"kB", "MB", "GB", "TB", "PB", "EB"})
+}
+
+func formatBytes(n int64, base int64, units []string) string {
+	if n < base && n > -base {
+		return fmt.Sprintf("%d B", n)
+	}
+	value := float64(n)
+	unit := -1
+	for (value >= float64(base) || value <= -float64(base)) && unit < len(units)-1 {
+		value /= float64(base)
+		unit++
+	}
+	return fmt.Sprintf("%.1f %s", value, units[unit])
+}
+
+// The unpacked size of the entry with binary units, like "1.5 MiB"
+func (e *TEntry) HumanSize() string {
+	return FormatBytes(e.Size)
+}
@@ -0,0 +1,113 @@
+package cli7z
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"strings"
+)
+
+// Compute the hash of every file entry, keyed by path, with algo CRC32, SHA1 or SHA256.
+// Hashes are uppercase hex like the CRC of the listing.
+// "7z h" only hashes files on disk, so the entries are streamed out of the archive (using f.Password)
+// and hashed here, nothing is written to disk. A single 7z x -so pass writes all the files in archive
+// order, split by their listed Size. Without sizes for all files, each one is streamed on its own,
+// which for a solid archive (see IsSolid) decompresses its block from the start every time.
+func (f *TFile) Hashes(algo string) (map[string]string, error) {
+
+	newHash, err := hashFunc(algo)
+	if err != nil {
+		return nil, err
+	}
+
+	files := f.Files()
+	for _, entry := range files {
+		if entry.Data["Size"] == "" {
+			return f.hashEach(files, newHash)
+		}
+	}
+
+	ctx, cancel := f.withTimeout(context.Background())
+	defer cancel()
+
+	// 7z x -so -bd -p ./zip.zip
+	args, stdin := f.withPassword(f.Password, "x", "-so", "-bd", f.File)
+	cmd := f.command(ctx, args...)
+	cmd.Stdin = stdin
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, binaryError(err, f.binary())
+	}
+
+	// Stop the 7z process and return err, or the 7z error which caused it
+	stop := func(err error) (map[string]string, error) {
+		cancel()
+		if waitErr := cmd.Wait(); waitErr != nil && stderr.Len() > 0 {
+			return nil, exitError(waitErr, stderr.String())
+		}
+		return nil, err
+	}
+
+	hashes := make(map[string]string)
+	for _, entry := range files {
+		h := newHash()
+		if _, err := io.CopyN(h, stdout, entry.Size); err != nil {
+			return stop(fmt.Errorf("%s: %w", entry.Data["Path"], err))
+		}
+		hashes[entry.Data["Path"]] = strings.ToUpper(hex.EncodeToString(h.Sum(nil)))
+	}
+	if n, _ := io.Copy(io.Discard, stdout); n > 0 {
+		return stop(fmt.Errorf("7z wrote %d bytes more than the listed sizes", n))
+	}
+
+	if err := f.timeoutError(context.Background(), ctx, cmd.Wait()); err != nil {
+		return nil, exitError(err, stderr.String())
+	}
+	return hashes, nil
+}
+
+// Hash each file streamed on its own with OpenEntry
+func (f *TFile) hashEach(files []*TEntry, newHash func() hash.Hash) (map[string]string, error) {
+
+	hashes := make(map[string]string)
+	for _, entry := range files {
+		name := entry.Data["Path"]
+		r, err := f.OpenEntry(name, f.Password)
+		if err != nil {
+			return nil, err
+		}
+		h := newHash()
+		if _, err := io.Copy(h, r); err != nil {
+			r.Close()
+			return nil, err
+		}
+		if err := r.Close(); err != nil {
+			return nil, err
+		}
+		hashes[name] = strings.ToUpper(hex.EncodeToString(h.Sum(nil)))
+	}
+	return hashes, nil
+}
+
+func hashFunc(algo string) (func() hash.Hash, error) {
+	switch strings.ToUpper(algo) {
+	case "CRC32":
+		return func() hash.Hash { return crc32.NewIEEE() }, nil
+	case "SHA1":
+		return sha1.New, nil
+	case "SHA256":
+		return sha256.New, nil
+	}
+	return nil, fmt.Errorf("unsupported hash algorithm %q", algo)
+}
@@ -0,0 +1,60 @@
+package cli7z
+
+// Check if the archive is solid ("Solid = +" header), so extracting a single file means
+// decompressing everything before it. False when 7z reports no such marker.
+func (f *TFile) IsSolid() bool {
+	if f.Header == nil {
+		return false
+	}
+	return f.Header.Solid()
+}
+
+// Size of the archive file ("Physical Size"), 0 if not reported
+func (h *THeader) PhysicalSize() int64 {
+	return parseSize(h.Data["Physical Size"])
+}
+
+// Size of the archive headers ("Headers Size"), 0 if not reported
+func (h *THeader) HeadersSize() int64 {
+	return parseSize(h.Data["Headers Size"])
+}
+
+// Compression methods of the archive, like "LZMA2:24 BCJ"
+func (h *THeader) Method() string {
+	return h.Data["Method"]
+}
+
+// Check the "Solid = +" marker
+func (h *THeader) Solid() bool {
+	return h.Data["Solid"] == "+"
+}
+
+// Number of solid blocks ("Blocks"), 0 if not reported
+func (h *THeader) Blocks() int {
+	return int(parseSize(h.Data["Blocks"]))
+}
+
+// System the archive was made on ("Host OS"), like "Unix" or "FAT", empty if not reported.
+// 7z gives it in the header of formats like rar and arj, and per entry in zip (see TEntry.HostOS).
+func (h *THeader) HostOS() string {
+	return h.Data["Host OS"]
+}
+
+// Version of the tool which made the archive ("Version"), like "20", empty if not reported
+func (h *THeader) Version() string {
+	return h.Data["Version"]
+}
+
+// System the entry was added on ("Host OS"), empty if not reported. Unix permission bits
+// in Attributes are only meaningful for "Unix".
+func (e *TEntry) HostOS() string {
+	return e.Data["Host OS"]
+}
+
+// The archive comment of zip and 7z archives, lines joined with "\n", empty if none
+func (f *TFile) Comment() string {
+	if f.Header == nil {
+		return ""
+	}
+	return f.Header.Data["Comment"]
+}
@@ -0,0 +1,48 @@
+package cli7z
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type jsonFile struct {
+	File      string      `json:"file"`
+	Type      string      `json:"type"`
+	Encrypted bool        `json:"encrypted"`
+	Entries   []jsonEntry `json:"entries"`
+}
+
+type jsonEntry struct {
+	Name       string            `json:"name"`
+	Size       int64             `json:"size"`
+	PackedSize int64             `json:"packedSize"`
+	Modified   *time.Time        `json:"modified,omitempty"`
+	IsDir      bool              `json:"isDir"`
+	Raw        map[string]string `json:"raw"`
+}
+
+// Marshal the listing as {"file", "type", "encrypted", "entries": [{"name", "size", "packedSize",
+// "modified", "isDir", "raw"}]} where raw holds the Data map of the entry
+func (f TFile) MarshalJSON() ([]byte, error) {
+	out := jsonFile{
+		File:      f.File,
+		Type:      f.Type,
+		Encrypted: f.Encrypted,
+		Entries:   []jsonEntry{},
+	}
+	for _, entry := range f.Entries {
+		e := jsonEntry{
+			Name:       entry.Data["Path"],
+			Size:       entry.Size,
+			PackedSize: entry.PackedSize,
+			IsDir:      entry.IsDir(),
+			Raw:        entry.Data,
+		}
+		if !entry.Modified.IsZero() {
+			modified := entry.Modified
+			e.Modified = &modified
+		}
+		out.Entries = append(out.Entries, e)
+	}
+	return json.Marshal(out)
+}
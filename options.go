@@ -0,0 +1,377 @@
+package cli7z
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Option configures an operation
+type Option func(*options) error
+
+type options struct {
+	ctx              context.Context
+	format           string
+	password         string
+	binary           string
+	runner           Runner
+	skipListing      bool
+	volumeSize       string
+	level            int
+	method           string
+	encryptHdrs      bool
+	overwrite        OverwriteMode
+	requireMatch     bool
+	threads          int
+	memoryLimit      string
+	stripComponents  int
+	comment          string
+	passwordFunc     func() (string, error)
+	passwordViaStdin bool
+	sfx              bool
+	sfxModule        string
+	attempts         int
+	backoff          time.Duration
+}
+
+func newOptions(opts []Option) (*options, error) {
+	o := &options{ctx: context.Background(), level: -1, overwrite: OverwriteAll}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+	return o, nil
+}
+
+// Set the archive format (7z -t switch) instead of guessing it from the extension
+func WithFormat(format string) Option {
+	return func(o *options) error {
+		if format == "" {
+			return errors.New("empty format")
+		}
+		o.format = format
+		return nil
+	}
+}
+
+// Size with an optional b, k, m or g unit, like "100m"
+var sizeRegexp = regexp.MustCompile(`^\d+[bkmg]?$`)
+
+// Check if size is a non-zero number with an optional b, k, m or g unit
+func validSize(size string) bool {
+	return sizeRegexp.MatchString(size) && strings.Trim(size, "0bkmg") != ""
+}
+
+// Split the created archive in volumes of the given size, like "100m" (7z -v switch).
+// Units are b, k, m and g, bytes if omitted.
+func WithVolumeSize(size string) Option {
+	return func(o *options) error {
+		if !validSize(size) {
+			return fmt.Errorf("invalid volume size %q, expected a number with an optional b, k, m or g unit", size)
+		}
+		o.volumeSize = size
+		return nil
+	}
+}
+
+// Set the compression level from 0 (store) to 9 (ultra) of the created archive (7z -mx switch)
+func WithCompressionLevel(level int) Option {
+	return func(o *options) error {
+		if level < 0 || level > 9 {
+			return fmt.Errorf("invalid compression level %d, expected 0 to 9", level)
+		}
+		o.level = level
+		return nil
+	}
+}
+
+// Compression methods 7z can create by archive format
+var methodsByFormat = map[string][]string{
+	"7z":  {"LZMA2", "LZMA", "PPMd", "BZip2", "Deflate", "Copy"},
+	"zip": {"Deflate", "Deflate64", "BZip2", "LZMA", "PPMd", "Copy"},
+}
+
+// Set the compression method of the created archive (7z -m0 switch, -mm for zip).
+// Valid for 7z: LZMA2, LZMA, PPMd, BZip2, Deflate, Copy; for zip: Deflate, Deflate64, BZip2, LZMA, PPMd, Copy.
+// Other formats have a fixed method.
+func WithMethod(method string) Option {
+	return func(o *options) error {
+		for _, methods := range methodsByFormat {
+			for _, m := range methods {
+				if strings.EqualFold(m, method) {
+					o.method = m
+					return nil
+				}
+			}
+		}
+		return fmt.Errorf("unknown compression method %q", method)
+	}
+}
+
+// Use the password to list (Open) or encrypt (Create) the archive
+func WithPassword(password string) Option {
+	return func(o *options) error {
+		o.password = password
+		return nil
+	}
+}
+
+// Write the password to the 7z stdin prompt instead of passing -p, keeping it out of the process list.
+// Sets TFile.PasswordViaStdin for Open, Create writes it twice for the confirmation prompt of 7z a.
+func WithPasswordViaStdin() Option {
+	return func(o *options) error {
+		o.passwordViaStdin = true
+		return nil
+	}
+}
+
+// Ask fn for the password once the archive turns out to be encrypted and no password was given,
+// like prompting on a TTY. Used by Open and Extract, an error of fn aborts them with that error.
+func WithPasswordFunc(fn func() (string, error)) Option {
+	return func(o *options) error {
+		if fn == nil {
+			return errors.New("nil password func")
+		}
+		o.passwordFunc = fn
+		return nil
+	}
+}
+
+// Set o.password from o.passwordFunc when no password was given
+func (o *options) askPassword() error {
+	if o.password != "" || o.passwordFunc == nil {
+		return nil
+	}
+	password, err := o.passwordFunc()
+	if err != nil {
+		return err
+	}
+	o.password = password
+	return nil
+}
+
+// Use the first line of the file at path as password, keeping it out of the code and arguments.
+// A missing file or an empty first line is an error.
+func WithPasswordFile(path string) Option {
+	return func(o *options) error {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("password file: %w", err)
+		}
+		line, _, _ := strings.Cut(string(data), "\n")
+		line = strings.TrimSuffix(line, "\r")
+		if line == "" {
+			return errors.New("password file: empty first line in " + path)
+		}
+		o.password = line
+		return nil
+	}
+}
+
+// Also encrypt the file names of the created 7z archive (7z -mhe switch), needs WithPassword.
+// Such an archive opened without the password reports the "encrypted archive" Type.
+func WithEncryptedHeaders(encrypt bool) Option {
+	return func(o *options) error {
+		o.encryptHdrs = encrypt
+		return nil
+	}
+}
+
+// Try Open and Extract up to attempts times while they fail with an error which may be transient,
+// waiting backoff before the first retry and twice as long before each next one. Not retried are
+// the sentinel errors (wrong password, unsupported format, ...), a done context and the 7z exit codes
+// other than ExitFatal, only I/O like failures are. A retried extraction runs again from the start.
+func WithRetry(attempts int, backoff time.Duration) Option {
+	return func(o *options) error {
+		if attempts < 1 || backoff < 0 {
+			return fmt.Errorf("invalid retry %d times after %s", attempts, backoff)
+		}
+		o.attempts = attempts
+		o.backoff = backoff
+		return nil
+	}
+}
+
+// Run fn as set by WithRetry
+func (o *options) retry(fn func() error) error {
+	backoff := o.backoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= o.attempts || !retryable(err) {
+			return err
+		}
+		select {
+		case <-o.ctx.Done():
+			return o.ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// Create a self-extracting 7z archive (7z -sfx switch) with the given stub module,
+// or the default one shipped next to the 7z binary when empty. A given module must exist.
+func WithSFX(module string) Option {
+	return func(o *options) error {
+		if module != "" && !fileExists(module) {
+			return errors.New("sfx module not found: " + module)
+		}
+		o.sfx = true
+		o.sfxModule = module
+		return nil
+	}
+}
+
+// What to do with files already in the destination folder on extraction (7z -ao switch)
+type OverwriteMode string
+
+const (
+	OverwriteAll    OverwriteMode = "-aoa"
+	SkipExisting    OverwriteMode = "-aos"
+	RenameExtracted OverwriteMode = "-aou"
+	RenameExisting  OverwriteMode = "-aot"
+)
+
+// Set how Extract handles files already in the destination folder
+func WithOverwriteMode(mode OverwriteMode) Option {
+	return func(o *options) error {
+		switch mode {
+		case OverwriteAll, SkipExisting, RenameExtracted, RenameExisting:
+			o.overwrite = mode
+			return nil
+		}
+		return fmt.Errorf("invalid overwrite mode %q", mode)
+	}
+}
+
+// Make ExtractMatching fail when an include pattern matches no entry
+func WithRequireMatch() Option {
+	return func(o *options) error {
+		o.requireMatch = true
+		return nil
+	}
+}
+
+// Cap the CPU threads 7z uses to create or extract (7z -mmt switch), 0 lets 7z decide
+func WithThreads(n int) Option {
+	return func(o *options) error {
+		if n < 0 {
+			return fmt.Errorf("invalid thread count %d", n)
+		}
+		o.threads = n
+		return nil
+	}
+}
+
+// Limit the memory 7z may use to create or extract, like "512m" (7z -mmemuse switch),
+// so operations needing more fail instead of exhausting the memory.
+// Units are b, k, m and g, bytes if omitted. Needs 7-Zip 22 or newer, older builds return an error.
+func WithMemoryLimit(size string) Option {
+	return func(o *options) error {
+		if !validSize(size) {
+			return fmt.Errorf("invalid memory limit %q, expected a number with an optional b, k, m or g unit", size)
+		}
+		o.memoryLimit = size
+		return nil
+	}
+}
+
+// The switches shared by the create and extract commands
+func (o *options) switches() []string {
+	var args []string
+	if o.threads > 0 {
+		args = append(args, "-mmt="+strconv.Itoa(o.threads))
+	}
+	if o.memoryLimit != "" {
+		args = append(args, "-mmemuse="+o.memoryLimit)
+	}
+	return args
+}
+
+// Check that the 7z binary of f supports the switches of o
+func (f *TFile) checkOptions(o *options) error {
+	if o.memoryLimit == "" {
+		return nil
+	}
+	major, _, raw, err := f.version(o.ctx)
+	if err != nil {
+		return err
+	}
+	if major < 22 {
+		return fmt.Errorf("memory limit needs 7-Zip 22 or newer, found %s", raw)
+	}
+	return nil
+}
+
+// Drop the first n path components of the entries on extraction, like tar --strip-components.
+// Entries with n components or less are not extracted. Not supported for archives with unsafe
+// paths extracted with TFile.StripUnsafePaths, Extract returns an ErrUnsafePath error then.
+func WithStripComponents(n int) Option {
+	return func(o *options) error {
+		if n < 0 {
+			return fmt.Errorf("invalid strip components %d", n)
+		}
+		o.stripComponents = n
+		return nil
+	}
+}
+
+// Set the archive comment of the created archive. Only zip archives are supported:
+// 7z has no switch for it, so the comment is written in the zip end record once 7z is done.
+func WithComment(text string) Option {
+	return func(o *options) error {
+		if len(text) > 0xFFFF {
+			return fmt.Errorf("comment of %d bytes, zip allows %d", len(text), 0xFFFF)
+		}
+		o.comment = text
+		return nil
+	}
+}
+
+// Use the given 7z binary instead of BINARY_NAME
+func WithBinary(binary string) Option {
+	return func(o *options) error {
+		if binary == "" {
+			return errors.New("empty binary")
+		}
+		o.binary = binary
+		return nil
+	}
+}
+
+// Run the 7z commands of Open, OpenReader, Create, Version, SupportedFormats, Benchmark and EntryCount
+// with r, see TFile.Runner
+func WithRunner(r Runner) Option {
+	return func(o *options) error {
+		if r == nil {
+			return errors.New("nil runner")
+		}
+		o.runner = r
+		return nil
+	}
+}
+
+// Keep Listing empty and only parse Entries, saves memory on huge archives
+func WithoutListing() Option {
+	return func(o *options) error {
+		o.skipListing = true
+		return nil
+	}
+}
+
+// Kill the running 7z process once ctx is done
+func WithContext(ctx context.Context) Option {
+	return func(o *options) error {
+		if ctx == nil {
+			return errors.New("nil context")
+		}
+		o.ctx = ctx
+		return nil
+	}
+}
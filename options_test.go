@@ -0,0 +1,27 @@
+package cli7z
+
+import "testing"
+
+func TestValidSize(t *testing.T) {
+	tests := []struct {
+		size string
+		want bool
+	}{
+		{"100m", true},
+		{"512", true},
+		{"1g", true},
+		{"10b", true},
+		{"0", false},
+		{"0m", false},
+		{"", false},
+		{"m", false},
+		{"1.5g", false},
+		{"100M", false},
+		{"-1k", false},
+	}
+	for _, test := range tests {
+		if got := validSize(test.size); got != test.want {
+			t.Errorf("validSize(%q) = %v, want %v", test.size, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package cli7z
+
+import (
+	"context"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// Try the candidates against the file with f.Workers concurrent 7z processes (runtime.NumCPU() if not set),
+// returning the first password found. The remaining tests are cancelled once one succeeds or ctx is done.
+// Unlike TestPassword it leaves ErrorState untouched.
+func (f *TFile) FindPassword(ctx context.Context, candidates []string) (string, bool) {
+
+	if (f.Type == "") || (!f.Encrypted) {
+		return "", false
+	}
+
+	workers := f.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan string)
+	found := make(chan string, 1)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for password := range jobs {
+				if f.checkPassword(ctx, password) {
+					select {
+					case found <- password:
+						cancel()
+					default:
+					}
+					return
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, password := range candidates {
+		select {
+		case jobs <- password:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	select {
+	case password := <-found:
+		return password, true
+	default:
+		return "", false
+	}
+}
+
+// Test a password without touching the state of f, so it can run concurrently
+func (f *TFile) checkPassword(ctx context.Context, password string) bool {
+	args, stdin := f.withPassword(password, "t", "-bd", f.File)
+	stdout, _, err := f.runSplit(ctx, stdin, args...)
+	if err != nil {
+		return false
+	}
+	return strings.Contains(string(stdout), "Everything is Ok")
+}
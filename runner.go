@@ -0,0 +1,356 @@
+package cli7z
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Runner runs the 7z binary name with args, feeding it stdin (may be nil).
+// Inject a fake one on TFile.Runner (or WithRunner) to test the parsing with canned 7z output.
+// Streaming operations (OpenEntry, ForEachEntry, ExtractWithProgress, ExtractToWriter) always
+// run the real binary.
+type Runner interface {
+	Run(ctx context.Context, stdin io.Reader, name string, args ...string) (stdout, stderr []byte, err error)
+}
+
+// Default Runner based on os/exec, in the WorkDir and with the Env of f
+type execRunner struct {
+	f *TFile
+}
+
+func (r execRunner) Run(ctx context.Context, stdin io.Reader, name string, args ...string) (stdout, stderr []byte, err error) {
+	cmd := r.f.newCmd(ctx, name, args...)
+	cmd.Stdin = stdin
+	var outBuf, errBuf bytes.Buffer
+	cmd.Stdout = &outBuf
+	cmd.Stderr = &errBuf
+	err = cmd.Run()
+	return outBuf.Bytes(), errBuf.Bytes(), err
+}
+
+// Build a 7z command for this file's binary
+func (f *TFile) command(ctx context.Context, args ...string) *exec.Cmd {
+	args = f.commandArgs(args)
+	f.logStart(args)
+	return f.newCmd(ctx, f.binary(), args...)
+}
+
+// Build the command of name in f.WorkDir, with f.Env over the English messages environment
+func (f *TFile) newCmd(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = f.WorkDir
+	cmd.Env = append(englishEnv(os.Environ()), f.Env...)
+	return cmd
+}
+
+// Path p as the 7z processes running in f.WorkDir see it, for the file operations done in Go
+func (f *TFile) localPath(p string) string {
+	if f.WorkDir == "" || filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(f.WorkDir, p)
+}
+
+// Force English messages on env with LC_MESSAGES=C. LC_ALL would override it, so its value
+// is moved to LC_CTYPE, keeping the charset 7z converts file names with. LANG=C would change it too.
+func englishEnv(env []string) []string {
+	result := make([]string, 0, len(env)+2)
+	ctype := ""
+	for _, v := range env {
+		if value, ok := strings.CutPrefix(v, "LC_ALL="); ok {
+			ctype = value
+			continue
+		}
+		result = append(result, v)
+	}
+	// Last wins for duplicate variables, as LC_ALL did over LC_CTYPE
+	if ctype != "" {
+		result = append(result, "LC_CTYPE="+ctype)
+	}
+	return append(result, "LC_MESSAGES=C")
+}
+
+// Commands taking f.ExtraArgs
+var extraArgsCommands = []string{"l", "x", "e", "t"}
+
+// Insert the console charset switch and, for list, extract and test commands, f.ExtraArgs
+// after the command name
+func (f *TFile) commandArgs(args []string) []string {
+	if len(args) == 0 {
+		return args
+	}
+	result := []string{args[0]}
+	if !f.NativeCharset && runtime.GOOS != "windows" {
+		result = append(result, "-sccUTF-8")
+	}
+	if slices.Contains(extraArgsCommands, args[0]) {
+		result = append(result, f.ExtraArgs...)
+	}
+	return append(result, args[1:]...)
+}
+
+// Add the password to a 7z command, either as -p switch right after the command name
+// or as the stdin to feed the prompt with when PasswordViaStdin is set
+func (f *TFile) withPassword(password string, args ...string) ([]string, io.Reader) {
+	if f.PasswordViaStdin {
+		return args, strings.NewReader(password + "\n")
+	}
+	result := []string{args[0], "-p" + password}
+	return append(result, args[1:]...), nil
+}
+
+// Run a 7z command and return its combined output
+func (f *TFile) run(ctx context.Context, args ...string) (string, error) {
+	return f.runInput(ctx, nil, args...)
+}
+
+// Run a 7z command with the given stdin and return its output, stdout followed by stderr.
+// The stderr alone is kept in f.Stderr.
+func (f *TFile) runInput(ctx context.Context, stdin io.Reader, args ...string) (string, error) {
+	f.Warnings = nil
+	stdout, stderr, err := f.runSplit(ctx, stdin, args...)
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+	f.Stderr = string(stderr)
+	data := string(stdout) + string(stderr)
+	f.setLastOutput(data)
+	return data, err
+}
+
+// Bytes of output kept in LastOutput, its end
+const maxLastOutput = 1 << 20
+
+// Keep the end of a 7z output in f.LastOutput
+func (f *TFile) setLastOutput(data string) {
+	if len(data) > maxLastOutput {
+		// Copied so the whole output is not held
+		data = strings.Clone(data[len(data)-maxLastOutput:])
+	}
+	f.LastOutput = data
+}
+
+// Run a 7z command with the given stdin, capturing stdout and stderr separately.
+// Goes through f.Runner when set.
+func (f *TFile) runSplit(parent context.Context, stdin io.Reader, args ...string) (stdout, stderr []byte, err error) {
+	ctx, cancel := f.withTimeout(parent)
+	defer cancel()
+	start := time.Now()
+	var runner Runner = execRunner{f}
+	if f.Runner != nil {
+		runner = f.Runner
+	}
+	args = f.commandArgs(args)
+	f.logStart(args)
+	stdout, stderr, err = runner.Run(ctx, stdin, f.binary(), args...)
+	f.logEnd(err, start)
+	return stdout, stderr, f.timeoutError(parent, ctx, binaryError(err, f.binary()))
+}
+
+// Log a 7z command line to f.Logger, with the password of -p masked
+func (f *TFile) logStart(args []string) {
+	if f.Logger == nil {
+		return
+	}
+	masked := make([]string, len(args))
+	for i, arg := range args {
+		if strings.HasPrefix(arg, "-p") && len(arg) > 2 {
+			arg = "-p***"
+		}
+		masked[i] = arg
+	}
+	f.Logger.Debug("7z start", "binary", f.binary(), "args", masked)
+}
+
+// Log the exit code of a 7z command to f.Logger, -1 if it could not run or was killed
+func (f *TFile) logEnd(err error, start time.Time) {
+	if f.Logger == nil {
+		return
+	}
+	code := 0
+	if err != nil {
+		code = -1
+		var execErr *exec.ExitError
+		var exitErr *ExitError
+		switch {
+		case errors.As(err, &execErr):
+			code = execErr.ExitCode()
+		case errors.As(err, &exitErr):
+			code = exitErr.Code
+		}
+	}
+	f.Logger.Debug("7z end", "binary", f.binary(), "code", code, "duration", time.Since(start), "error", err)
+}
+
+// Bound ctx by f.Timeout when set
+func (f *TFile) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if f.Timeout > 0 {
+		return context.WithTimeout(ctx, f.Timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// Turn the error of a 7z process killed by f.Timeout (ctx expired but not parent) into ErrTimeout
+func (f *TFile) timeoutError(parent, ctx context.Context, err error) error {
+	if err != nil && parent.Err() == nil && ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("%w after %s", ErrTimeout, f.Timeout)
+	}
+	return err
+}
+
+// Check that the 7z binary (BINARY_NAME, resolved if left at its default) can be found,
+// to fail fast at startup. Returns an ErrBinaryNotFound error otherwise.
+func CheckBinary() error {
+	binary := (&TFile{}).binary()
+	_, err := exec.LookPath(binary)
+	return binaryError(err, binary)
+}
+
+// Binary names 7-Zip ships under, in probing order
+var binaryNames = []string{"7zz", "7za", "7z"}
+
+var resolved struct {
+	sync.Mutex
+	binary string
+}
+
+// Find the first of 7zz, 7za and 7z in PATH. The result is cached once found.
+func ResolveBinary() (string, error) {
+	resolved.Lock()
+	defer resolved.Unlock()
+	if resolved.binary != "" {
+		return resolved.binary, nil
+	}
+	for _, name := range binaryNames {
+		if _, err := exec.LookPath(name); err == nil {
+			resolved.binary = name
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("none of %s: %w", strings.Join(binaryNames, ", "), ErrBinaryNotFound)
+}
+
+// Longest 7z output line read, a zip comment alone may take 64 KiB
+const maxLineSize = 1 << 20
+
+// Scanner of 7z output lines up to maxLineSize
+func newScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxLineSize)
+	return scanner
+}
+
+// Split a cmd output into lines
+func splitLines(data string) ([]string, error) {
+	var lines []string
+	scanner := newScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		lines = append(lines, trimLine(scanner.Text()))
+	}
+	return lines, scanner.Err()
+}
+
+// Byte order mark some 7z builds print before their output
+const bom = "\uFEFF"
+
+// Drop the carriage returns left at the end of a scanned line and a leading BOM. The scanner
+// removes the CR of a CRLF ending, 7z on Windows may still leave more ("Type = zip\r\r\n").
+func trimLine(line string) string {
+	return strings.TrimRight(strings.TrimPrefix(line, bom), "\r")
+}
+
+// Run a 7z command and check its output for success. Returns the whole cmd stdout if error.
+func (f *TFile) execute(ctx context.Context, args ...string) error {
+	return f.executeInput(ctx, nil, args...)
+}
+
+// Same as execute, with the given stdin
+func (f *TFile) executeInput(ctx context.Context, stdin io.Reader, args ...string) error {
+	_, err := f.executeOutput(ctx, stdin, args...)
+	return err
+}
+
+// Same as executeInput, also returning the output lines
+func (f *TFile) executeOutput(ctx context.Context, stdin io.Reader, args ...string) ([]string, error) {
+
+	data, runErr := f.runInput(ctx, stdin, args...)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	lines, err := splitLines(data)
+	if err != nil {
+		return nil, fmt.Errorf("reading 7z output: %w", err)
+	}
+
+	f.collectWarnings(lines)
+
+	for _, line := range lines {
+		if line == "Everything is Ok" {
+			return lines, nil
+		}
+	}
+	if runErr != nil {
+		return lines, f.allowWarnings(exitError(runErr, data))
+	}
+	return lines, wrapOutput(errors.New(data), data)
+}
+
+// Keep the warning lines of a 7z output in f.Warnings, like "WARNING: ..." or
+// "Cannot create symbolic link : ..." for items skipped without failing the whole operation
+func (f *TFile) collectWarnings(lines []string) {
+	for _, line := range lines {
+		if strings.HasPrefix(line, "WARNING") || strings.HasPrefix(line, "Cannot ") {
+			f.Warnings = append(f.Warnings, line)
+		}
+	}
+}
+
+// Drop a warnings only exit error when AllowWarnings is set
+func (f *TFile) allowWarnings(err error) error {
+	var exitErr *ExitError
+	if f.AllowWarnings && errors.As(err, &exitErr) && exitErr.Code == ExitWarning {
+		return nil
+	}
+	return err
+}
+
+// Run 7z with args followed by the archive, for the commands this package does not cover,
+// like Run("l", "-ba"). Uses the binary, timeout and environment of f. As for every command,
+// -sccUTF-8 is added outside Windows (unless NativeCharset) and ExtraArgs to l, x, e and t,
+// nothing else: pass -p for a password. The output is not parsed, a non-zero exit code is an *ExitError.
+func (f *TFile) Run(args ...string) (stdout, stderr []byte, err error) {
+	if len(args) == 0 {
+		return nil, nil, errors.New("no 7z command")
+	}
+	// Not appended in place, args may be a slice of the caller with spare capacity
+	return f.runRaw(append(slices.Clone(args), f.File)...)
+}
+
+// Run 7z with args alone, see (*TFile).Run
+func Run(args ...string) (stdout, stderr []byte, err error) {
+	if len(args) == 0 {
+		return nil, nil, errors.New("no 7z command")
+	}
+	return (&TFile{}).runRaw(args...)
+}
+
+// Run a 7z command keeping its outputs apart, Stderr and LastOutput are set as by runInput
+func (f *TFile) runRaw(args ...string) (stdout, stderr []byte, err error) {
+	stdout, stderr, err = f.runSplit(context.Background(), nil, args...)
+	f.Stderr = string(stderr)
+	f.setLastOutput(string(stdout) + string(stderr))
+	return stdout, stderr, exitError(err, string(stdout)+string(stderr))
+}
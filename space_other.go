@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package cli7z
+
+import "errors"
+
+// Free space is not checked on this platform
+func freeSpace(path string) (uint64, error) {
+	return 0, errors.ErrUnsupported
+}
@@ -0,0 +1,187 @@
+package cli7z
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Banner line of 7zz, 7za and 7z builds:
+// "7-Zip (z) 23.01 (x64) : ...", "7-Zip (a) [64] 16.02 : ...", "7-Zip [64] 16.02 : ..."
+var versionRegexp = regexp.MustCompile(`^7-Zip(?: \([a-z]+\))?(?: \[\d+\])? (\d+)\.(\d+)`)
+
+// Report the version of the installed 7z binary (BINARY_NAME unless WithBinary) and its raw banner line.
+// Takes WithBinary, WithRunner and WithContext.
+func Version(opts ...Option) (major, minor int, raw string, err error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return 0, 0, "", err
+	}
+	return (&TFile{Binary: o.binary, Runner: o.runner}).version(o.ctx)
+}
+
+// Report the version of the 7z binary of f
+func (f *TFile) version(ctx context.Context) (major, minor int, raw string, err error) {
+
+	data, runErr := f.run(ctx)
+	if runErr != nil && data == "" {
+		return 0, 0, "", runErr
+	}
+
+	lines, err := splitLines(data)
+	if err != nil {
+		return 0, 0, "", err
+	}
+
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		match := versionRegexp.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		major, _ = strconv.Atoi(match[1])
+		minor, _ = strconv.Atoi(match[2])
+		return major, minor, line, nil
+	}
+	return 0, 0, "", errors.New("no 7-Zip version banner found: " + data)
+}
+
+// Archive format supported by the installed 7z binary
+type Format struct {
+	Name       string
+	Extensions []string
+	// Archives of this format can be created, otherwise extraction only
+	CanCreate bool
+}
+
+// A format line of "7zz i" is made of an optional library index, the "C" update flag glued to
+// the format flags (dots when unset), the name, the extensions and the signature:
+// "  0 C...F.........  7z       7z            7 z BC AF 27 1C"
+var formatRegexp = regexp.MustCompile(`^\s*(?:\d+\s+)?(C?)[A-Za-z.+]+\s+(\S+)\s+(.*)$`)
+
+// Signature tokens following a long extension list: hex bytes, offsets and alternatives
+var signatureRegexp = regexp.MustCompile(`^([0-9A-F]{2}|[A-Z0-9]|.*=.*|\|\|)$`)
+
+// List the archive formats the installed 7z binary (BINARY_NAME unless WithBinary) supports, parsed
+// from "7zz i". The format table layout is the one of 7-Zip 21 and newer. Takes WithBinary, WithRunner
+// and WithContext.
+func SupportedFormats(opts ...Option) ([]Format, error) {
+
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	f := &TFile{Binary: o.binary, Runner: o.runner}
+	data, err := f.run(o.ctx, "i")
+	if err != nil {
+		return nil, exitError(err, data)
+	}
+
+	lines, err := splitLines(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var formats []Format
+	inTable := false
+	for _, line := range lines {
+		if line == "Formats:" {
+			inTable = true
+			continue
+		}
+		if !inTable {
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			break
+		}
+		match := formatRegexp.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		formats = append(formats, Format{
+			Name:       match[2],
+			Extensions: parseExtensions(match[3]),
+			CanCreate:  match[1] == "C",
+		})
+	}
+	if len(formats) == 0 {
+		return nil, errors.New("no formats found: " + data)
+	}
+	return formats, nil
+}
+
+// Extensions are padded to a column before the signature, a longer list is followed by a single space
+func parseExtensions(s string) []string {
+	list, _, _ := strings.Cut(s, "  ")
+	var exts []string
+	for _, ext := range strings.Fields(list) {
+		if len(exts) > 0 && signatureRegexp.MatchString(ext) {
+			break
+		}
+		exts = append(exts, ext)
+	}
+	return exts
+}
+
+// Figures of the 7z built-in benchmark (7zz b), speeds in KiB/s and ratings in MIPS
+type BenchResult struct {
+	CompressSpeed     int
+	CompressRating    int
+	DecompressSpeed   int
+	DecompressRating  int
+	TotalUsagePercent int
+	TotalRating       int
+	// The whole benchmark output
+	Raw string
+}
+
+// Run the 7z benchmark (BINARY_NAME unless WithBinary), which takes a while, and parse its averages
+// and total rating: "Avr:  49021   350  13900  48616  |   599234   399  12987  51823" and
+// "Tot:  374  13443  50219". Takes WithBinary, WithRunner and WithContext.
+func Benchmark(opts ...Option) (BenchResult, error) {
+
+	o, err := newOptions(opts)
+	if err != nil {
+		return BenchResult{}, err
+	}
+	f := &TFile{Binary: o.binary, Runner: o.runner}
+	data, err := f.run(o.ctx, "b")
+	if err != nil {
+		return BenchResult{}, exitError(err, data)
+	}
+
+	lines, err := splitLines(data)
+	if err != nil {
+		return BenchResult{}, err
+	}
+
+	result := BenchResult{Raw: data}
+	found := false
+	for _, line := range lines {
+		if rest, ok := strings.CutPrefix(line, "Avr:"); ok {
+			compress, decompress, _ := strings.Cut(rest, "|")
+			if fields := strings.Fields(compress); len(fields) == 4 {
+				result.CompressSpeed, _ = strconv.Atoi(fields[0])
+				result.CompressRating, _ = strconv.Atoi(fields[3])
+			}
+			if fields := strings.Fields(decompress); len(fields) == 4 {
+				result.DecompressSpeed, _ = strconv.Atoi(fields[0])
+				result.DecompressRating, _ = strconv.Atoi(fields[3])
+			}
+		}
+		if rest, ok := strings.CutPrefix(line, "Tot:"); ok {
+			if fields := strings.Fields(rest); len(fields) == 3 {
+				result.TotalUsagePercent, _ = strconv.Atoi(fields[0])
+				result.TotalRating, _ = strconv.Atoi(fields[2])
+				found = true
+			}
+		}
+	}
+	if !found {
+		return result, errors.New("no total rating found: " + data)
+	}
+	return result, nil
+}
@@ -0,0 +1,95 @@
+package cli7z
+
+import (
+	"slices"
+	"testing"
+)
+
+// Runner answering any 7z command with stdout
+func outputRunner(stdout string) runnerFunc {
+	return func(args []string, stdin string) (string, string, error) {
+		return stdout, "", nil
+	}
+}
+
+func TestVersion(t *testing.T) {
+	tests := []struct {
+		banner       string
+		major, minor int
+	}{
+		{"7-Zip (z) 23.01 (x64) : Copyright (c) 1999-2023 Igor Pavlov : 2023-06-20", 23, 1},
+		{"7-Zip (a) [64] 16.02 : Copyright (c) 1999-2016 Igor Pavlov : 2016-05-21", 16, 2},
+		{"7-Zip [64] 16.02 : Copyright (c) 1999-2016 Igor Pavlov : 2016-05-21", 16, 2},
+	}
+	for _, test := range tests {
+		output := "\n" + test.banner + "\n\nUsage: 7zz <command> [<switches>...] <archive_name>\n"
+		major, minor, raw, err := Version(WithRunner(outputRunner(output)))
+		if err != nil {
+			t.Errorf("Version of %q: %v", test.banner, err)
+			continue
+		}
+		if major != test.major || minor != test.minor || raw != test.banner {
+			t.Errorf("Version of %q: %d.%d %q", test.banner, major, minor, raw)
+		}
+	}
+
+	if _, _, _, err := Version(WithRunner(outputRunner("p7zip Version 9.20\n"))); err == nil {
+		t.Error("Version without banner: no error")
+	}
+}
+
+func TestSupportedFormats(t *testing.T) {
+	output := "\n7-Zip (z) 23.01 (x64) : Copyright (c) 1999-2023 Igor Pavlov : 2023-06-20\n\n" +
+		"Libs:\n  0 : 23.01 : /usr/lib/7zz\n\nFormats:\n" +
+		"  0  ...F.........  APM      apm           E R\n" +
+		"  0 C...F.........  7z       7z            7 z BC AF 27 1C\n" +
+		"  0 C...F.........  xz       xz txz (.tar) FD 7 z X Z 00\n" +
+		"  0 C...F.........  zip      zip zipx jar xpi odt ods docx xlsx epub ipa apk appx  P K 03 04 || P K 05 06\n" +
+		"\nCodecs:\n  0 4ED   303011B BCJ2\n"
+
+	formats, err := SupportedFormats(WithRunner(outputRunner(output)))
+	if err != nil {
+		t.Fatalf("SupportedFormats: %v", err)
+	}
+	want := []Format{
+		{Name: "APM", Extensions: []string{"apm"}},
+		{Name: "7z", Extensions: []string{"7z"}, CanCreate: true},
+		{Name: "xz", Extensions: []string{"xz", "txz", "(.tar)"}, CanCreate: true},
+		{Name: "zip", Extensions: []string{"zip", "zipx", "jar", "xpi", "odt", "ods", "docx", "xlsx", "epub", "ipa", "apk", "appx"}, CanCreate: true},
+	}
+	if len(formats) != len(want) {
+		t.Fatalf("formats %+v", formats)
+	}
+	for i, format := range formats {
+		if format.Name != want[i].Name || format.CanCreate != want[i].CanCreate || !slices.Equal(format.Extensions, want[i].Extensions) {
+			t.Errorf("format %+v, want %+v", format, want[i])
+		}
+	}
+}
+
+func TestBenchmark(t *testing.T) {
+	output := "\n7-Zip (z) 23.01 (x64) : Copyright (c) 1999-2023 Igor Pavlov : 2023-06-20\n\n" +
+		"                       Compressing  |                  Decompressing\n" +
+		"Dict     Speed Usage    R/U Rating  |      Speed Usage    R/U Rating\n" +
+		"         KiB/s     %   MIPS   MIPS  |      KiB/s     %   MIPS   MIPS\n\n" +
+		"22:      47000   345  13251  45722  |     597145   398  12805  50983\n" +
+		"----------------------------------  | ------------------------------\n" +
+		"Avr:     49021   350  13900  48616  |     599234   399  12987  51823\n" +
+		"Tot:             374  13443  50219\n"
+
+	result, err := Benchmark(WithRunner(outputRunner(output)))
+	if err != nil {
+		t.Fatalf("Benchmark: %v", err)
+	}
+	want := BenchResult{
+		CompressSpeed: 49021, CompressRating: 48616, DecompressSpeed: 599234, DecompressRating: 51823,
+		TotalUsagePercent: 374, TotalRating: 50219, Raw: output,
+	}
+	if result != want {
+		t.Errorf("Benchmark %+v, want %+v", result, want)
+	}
+
+	if _, err := Benchmark(WithRunner(outputRunner("Avr: 1 2 3 4 | 5 6 7 8\n"))); err == nil {
+		t.Error("Benchmark without Tot line: no error")
+	}
+}
@@ -0,0 +1,96 @@
+package cli7z
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// archive.7z.001, archive.7z.002, ...
+	numberedVolumeRegexp = regexp.MustCompile(`^(.*\.)(\d{3,})$`)
+	// archive.part1.rar, archive.part2.rar, ...
+	rarVolumeRegexp = regexp.MustCompile(`^(.*\.part)(\d+)(\.rar)$`)
+)
+
+// List the volume files of a split archive, in order. 7z only needs the first one to be opened,
+// but all of them to extract. The count comes from the "Volumes" header when 7z reports it,
+// otherwise the consecutive existing siblings are taken.
+// Returns the expected names with an ErrMissingVolume naming the first absent file.
+// A single volume archive returns just f.File. A relative f.File is joined with WorkDir.
+func (f *TFile) Volumes() ([]string, error) {
+
+	count := 0
+	if f.Header != nil {
+		count, _ = strconv.Atoi(f.Header.Data["Volumes"])
+	}
+
+	file := f.localPath(f.File)
+	name := volumeNamer(file)
+	if name == nil {
+		return []string{file}, nil
+	}
+
+	var volumes []string
+	for i := 1; count == 0 || i <= count; i++ {
+		volume := name(i, count)
+		if count == 0 && !fileExists(volume) {
+			break
+		}
+		// The last part of a split zip is the .zip itself
+		if len(volumes) > 0 && volumes[len(volumes)-1] == volume {
+			break
+		}
+		volumes = append(volumes, volume)
+	}
+
+	for _, volume := range volumes {
+		if !fileExists(volume) {
+			return volumes, fmt.Errorf("%s: %w", volume, ErrMissingVolume)
+		}
+	}
+	return volumes, nil
+}
+
+// Build the naming function of the volumes (1 based, count 0 when unknown) of a split archive,
+// nil if file does not look like a volume
+func volumeNamer(file string) func(i int, count int) string {
+
+	if match := numberedVolumeRegexp.FindStringSubmatch(file); match != nil {
+		prefix, width := match[1], len(match[2])
+		return func(i int, _ int) string {
+			return fmt.Sprintf("%s%0*d", prefix, width, i)
+		}
+	}
+
+	if match := rarVolumeRegexp.FindStringSubmatch(file); match != nil {
+		prefix, width, suffix := match[1], len(match[2]), match[3]
+		return func(i int, _ int) string {
+			return fmt.Sprintf("%s%0*d%s", prefix, width, i, suffix)
+		}
+	}
+
+	// Split zip: archive.z01, archive.z02, ..., archive.zip as the last one
+	if strings.HasSuffix(strings.ToLower(file), ".zip") {
+		base := file[:len(file)-len(".zip")]
+		if !fileExists(base+".z01") && !fileExists(base+".Z01") {
+			return nil
+		}
+		return func(i int, count int) string {
+			part := fmt.Sprintf("%s.z%02d", base, i)
+			if (count > 0 && i == count) || (count == 0 && !fileExists(part)) {
+				return file
+			}
+			return part
+		}
+	}
+
+	return nil
+}
+
+func fileExists(file string) bool {
+	_, err := os.Stat(file)
+	return err == nil
+}